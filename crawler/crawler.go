@@ -1,47 +1,83 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-	"golang.org/x/net/html"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/net/html"
 )
 
+// task is a page waiting in the frontier, with the depth left to crawl.
+type task struct {
+	url   string
+	host  string
+	depth int
+}
+
 type Crawler struct {
-	visited map[string]bool
-	mu      sync.Mutex
-	wg      sync.WaitGroup
-	depth   int
+	visited  map[string]bool
+	mu       sync.Mutex
+	cond     *sync.Cond
+	depth    int
+	workers  int
+	perHost  int
+	frontier []task
+	active   map[string]int // pages being fetched, per host
+	busy     int            // pages being fetched in total
 }
 
-func NewCrawler(depth int) *Crawler {
-	return &Crawler{
+// NewCrawler returns a crawler that fetches at most workers pages at once,
+// and at most perHost of them from the same host.
+func NewCrawler(depth, workers, perHost int) *Crawler {
+	c := &Crawler{
 		visited: make(map[string]bool),
 		depth:   depth,
+		workers: max(workers, 1),
+		perHost: max(perHost, 1),
+		active:  make(map[string]int),
 	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
 }
 
-func (c *Crawler) fetch(url string) (*http.Response, error) {
-	resp, err := http.Get(url)
+func (c *Crawler) fetch(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	return resp, nil
+	return http.DefaultClient.Do(req)
 }
 
-func (c *Crawler) parse(resp *http.Response) []string {
-	var links []string
+// parse extracts the links of a page, resolved against the page's URL (or
+// its <base href>) without their fragments. Links that aren't web pages,
+// such as mailto: links, are dropped.
+func (c *Crawler) parse(resp *http.Response) []*url.URL {
+	var links []*url.URL
 	doc, err := html.Parse(resp.Body)
 	if err != nil {
 		return links
 	}
+	var base string
+	var hrefs []string
 	var f func(*html.Node)
 	f = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "a" {
+		if n.Type == html.ElementNode && (n.Data == "a" || n.Data == "base") {
 			for _, a := range n.Attr {
-				if a.Key == "href" {
-					links = append(links, a.Val)
+				if a.Key != "href" {
+					continue
+				}
+				if n.Data == "a" {
+					hrefs = append(hrefs, a.Val)
+				} else if base == "" {
+					base = a.Val
 				}
 			}
 		}
@@ -50,49 +86,208 @@ func (c *Crawler) parse(resp *http.Response) []string {
 		}
 	}
 	f(doc)
+
+	// resp.Request.URL is the page's URL after any redirects.
+	page := resp.Request.URL
+	if base != "" {
+		if u, err := page.Parse(strings.TrimSpace(base)); err == nil {
+			page = u
+		}
+	}
+	for _, href := range hrefs {
+		u, err := page.Parse(strings.TrimSpace(href))
+		if err != nil {
+			continue
+		}
+		if _, ok := normalizeURL(u); ok {
+			u.Fragment, u.RawFragment = "", ""
+			links = append(links, u)
+		}
+	}
 	return links
 }
 
-func (c *Crawler) crawl(url string, depth int) {
-	defer c.wg.Done()
-	if depth <= 0 {
+// trackingParams are query parameters that only tell a site where a visitor
+// came from. Parameters starting with "utm_" are dropped as well.
+var trackingParams = map[string]bool{
+	"gclid":   true,
+	"dclid":   true,
+	"fbclid":  true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+}
+
+// normalizeURL returns the key of an absolute URL in visited: lower-case
+// scheme and host, no default port, fragment, trailing slash or tracking
+// parameters, and the rest of the query sorted. The key is only used to
+// tell pages apart and is never fetched, as a server may treat /docs and
+// /docs/ differently. It returns false for anything but http and https URLs.
+func normalizeURL(u *url.URL) (string, bool) {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	if (n.Scheme != "http" && n.Scheme != "https") || n.Host == "" {
+		return "", false
+	}
+	n.Host = strings.ToLower(n.Host)
+	if n.Scheme == "http" {
+		n.Host = strings.TrimSuffix(n.Host, ":80")
+	} else {
+		n.Host = strings.TrimSuffix(n.Host, ":443")
+	}
+	n.Host = strings.TrimSuffix(n.Host, ":")
+	n.Fragment, n.RawFragment = "", ""
+
+	if n.Path == "" {
+		n.Path = "/"
+	}
+	if len(n.Path) > 1 {
+		n.Path = strings.TrimSuffix(n.Path, "/")
+		n.RawPath = strings.TrimSuffix(n.RawPath, "/")
+	}
+
+	if n.RawQuery != "" {
+		if query, err := url.ParseQuery(n.RawQuery); err == nil {
+			for key := range query {
+				if trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+					delete(query, key)
+				}
+			}
+			n.RawQuery = query.Encode()
+		}
+	}
+	n.ForceQuery = false
+	return n.String(), true
+}
+
+// enqueue adds a page to the frontier unless a page with the same
+// normalized URL was seen before. c.mu must be held.
+func (c *Crawler) enqueue(link *url.URL, depth int) {
+	key, ok := normalizeURL(link)
+	if depth <= 0 || !ok || c.visited[key] {
 		return
 	}
+	c.visited[key] = true
+	host := strings.ToLower(link.Hostname())
+	c.frontier = append(c.frontier, task{url: link.String(), host: host, depth: depth})
+	c.cond.Signal()
+}
+
+// next takes the first page in the frontier whose host is below its limit,
+// waiting while every such host is busy. It returns false once the crawl is
+// over: the frontier is empty and nothing is being fetched that could add
+// to it, or ctx was cancelled.
+func (c *Crawler) next(ctx context.Context) (task, bool) {
 	c.mu.Lock()
-	if c.visited[url] {
-		c.mu.Unlock()
-		return
+	defer c.mu.Unlock()
+	for ctx.Err() == nil {
+		for i, t := range c.frontier {
+			if c.active[t.host] < c.perHost {
+				c.frontier = slices.Delete(c.frontier, i, i+1)
+				c.active[t.host]++
+				c.busy++
+				return t, true
+			}
+		}
+		if len(c.frontier) == 0 && c.busy == 0 {
+			return task{}, false
+		}
+		c.cond.Wait()
 	}
-	c.visited[url] = true
-	c.mu.Unlock()
+	return task{}, false
+}
+
+// finish releases the host slot of a fetched page and queues its links.
+func (c *Crawler) finish(t task, links []*url.URL) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active[t.host]--
+	if c.active[t.host] == 0 {
+		delete(c.active, t.host)
+	}
+	c.busy--
+	for _, link := range links {
+		c.enqueue(link, t.depth-1)
+	}
+	// Wake every worker: a host slot is free, and if the crawl is over they
+	// all need to see it.
+	c.cond.Broadcast()
+}
 
-	fmt.Println("Fetching:", url)
-	resp, err := c.fetch(url)
+func (c *Crawler) crawl(ctx context.Context, t task) []*url.URL {
+	fmt.Println("Fetching:", t.url)
+	resp, err := c.fetch(ctx, t.url)
 	if err != nil {
-		fmt.Println("Error fetching:", err)
-		return
+		if ctx.Err() == nil {
+			fmt.Println("Error fetching:", err)
+		}
+		return nil
 	}
 	defer resp.Body.Close()
+	return c.parse(resp)
+}
 
-	links := c.parse(resp)
-	for _, link := range links {
-		c.wg.Add(1)
-		go c.crawl(link, depth-1)
+func (c *Crawler) work(ctx context.Context) {
+	for {
+		t, ok := c.next(ctx)
+		if !ok {
+			return
+		}
+		c.finish(t, c.crawl(ctx, t))
 	}
 }
 
-func (c *Crawler) Start(url string) {
-	c.wg.Add(1)
-	go c.crawl(url, c.depth)
-	c.wg.Wait()
+// Start crawls from the start URL until every page within the depth has
+// been fetched or ctx is cancelled. On cancellation, fetches in flight are
+// aborted, the workers stop and Start returns ctx's error.
+func (c *Crawler) Start(ctx context.Context, start string) error {
+	u, err := url.Parse(start)
+	if err != nil {
+		return err
+	}
+	if _, ok := normalizeURL(u); !ok {
+		return fmt.Errorf("%q is not an http or https URL", start)
+	}
+	c.mu.Lock()
+	c.enqueue(u, c.depth)
+	c.mu.Unlock()
+
+	// Waiting workers only wake up for the cond, so wake them on cancel.
+	stop := context.AfterFunc(ctx, func() {
+		c.mu.Lock()
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.work(ctx)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
 }
 
 func main() {
 	startURL := "https://example.com"
 	depth := 2
+	workers := 16
+	perHost := 4
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
 
-	crawler := NewCrawler(depth)
+	crawler := NewCrawler(depth, workers, perHost)
 	startTime := time.Now()
-	crawler.Start(startURL)
+	if err := crawler.Start(ctx, startURL); err != nil {
+		fmt.Println("Crawling stopped:", err)
+	}
 	fmt.Println("Crawling completed in", time.Since(startTime))
 }
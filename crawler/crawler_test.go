@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNextSkipsBusyHosts(t *testing.T) {
+	c := NewCrawler(2, 4, 1)
+	for _, link := range []string{"http://a.test/1", "http://a.test/2", "http://b.test/1"} {
+		u, _ := url.Parse(link)
+		c.enqueue(u, 2)
+	}
+	ctx := context.Background()
+	first, _ := c.next(ctx)
+	second, _ := c.next(ctx)
+	if first.url != "http://a.test/1" || second.url != "http://b.test/1" {
+		t.Fatalf("took %s then %s, want a.test/1 then b.test/1 while a.test is busy", first.url, second.url)
+	}
+	c.finish(first, nil)
+	third, _ := c.next(ctx)
+	if third.url != "http://a.test/2" {
+		t.Fatalf("took %s once a.test was free, want a.test/2", third.url)
+	}
+	c.finish(second, nil)
+	c.finish(third, nil)
+	if _, ok := c.next(ctx); ok {
+		t.Error("next returned a page from an empty frontier with nothing in flight")
+	}
+}
+
+// pageServer serves pages that each link to fanout pages below them, and
+// records how many requests it handles at once.
+type pageServer struct {
+	fanout int
+	delay  time.Duration
+
+	mu      sync.Mutex
+	fetched map[string]int
+	active  int
+	peak    int
+}
+
+func (s *pageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.fetched[r.URL.Path]++
+	s.active++
+	s.peak = max(s.peak, s.active)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	}()
+
+	time.Sleep(s.delay)
+	fmt.Fprint(w, "<html><body>")
+	for i := 0; i < s.fanout; i++ {
+		fmt.Fprintf(w, `<a href="%s/%d">page</a>`, strings.TrimSuffix(r.URL.Path, "/"), i)
+	}
+	fmt.Fprint(w, "</body></html>")
+}
+
+func TestCrawlPerHostLimit(t *testing.T) {
+	tests := []struct {
+		workers, perHost int
+	}{
+		{16, 3},
+		{2, 4},
+		{1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d workers, %d per host", tt.workers, tt.perHost), func(t *testing.T) {
+			s := &pageServer{fanout: 8, delay: 20 * time.Millisecond, fetched: make(map[string]int)}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			c := NewCrawler(2, tt.workers, tt.perHost)
+			if err := c.Start(context.Background(), srv.URL); err != nil {
+				t.Fatal(err)
+			}
+			if len(s.fetched) != 1+s.fanout {
+				t.Errorf("fetched %d pages, want %d", len(s.fetched), 1+s.fanout)
+			}
+			for path, n := range s.fetched {
+				if n != 1 {
+					t.Errorf("fetched %s %d times", path, n)
+				}
+			}
+			if limit := min(tt.workers, tt.perHost); s.peak > limit {
+				t.Errorf("fetched %d pages at once, want at most %d", s.peak, limit)
+			}
+		})
+	}
+}
+
+func TestCrawlStopsOnCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- NewCrawler(2, 4, 2).Start(ctx, srv.URL) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Start returned %v, want the context's error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start didn't return after the context was done")
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // "" when the URL isn't crawlable
+	}{
+		{"http://example.com", "http://example.com/"},
+		{"HTTP://Example.COM:80/Docs/", "http://example.com/Docs"},
+		{"https://example.com:443/a#section", "https://example.com/a"},
+		{"https://example.com:8443/a", "https://example.com:8443/a"},
+		{"http://example.com:443/a", "http://example.com:443/a"},
+		{"http://example.com/a?", "http://example.com/a"},
+		{"http://example.com/a?b=2&a=1", "http://example.com/a?a=1&b=2"},
+		{"http://example.com/a?utm_source=x&UTM_Medium=y&fbclid=z&id=3", "http://example.com/a?id=3"},
+		{"http://example.com/a?utm_source=x", "http://example.com/a"},
+		{"http://example.com/a%2Fb/", "http://example.com/a%2Fb"},
+		{"mailto:someone@example.com", ""},
+		{"ftp://example.com/file", ""},
+		{"javascript:void(0)", ""},
+		{"/relative/path", ""},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := normalizeURL(u)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("normalizeURL(%q) = %q, %v; want %q", tt.in, got, ok, tt.want)
+		}
+	}
+}
+
+func TestParseResolvesLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		body string
+		want []string
+	}{
+		{
+			"relative to a directory",
+			"http://example.com/docs/",
+			`<a href="a">a</a> <a href="../b#top">b</a> <a href=" /c?x=1 ">c</a> <a href="#top">self</a>`,
+			[]string{"http://example.com/docs/a", "http://example.com/b", "http://example.com/c?x=1", "http://example.com/docs/"},
+		},
+		{
+			"relative to a file",
+			"http://example.com/docs/index.html",
+			`<a href="a">a</a> <a href="//other.test/x">x</a>`,
+			[]string{"http://example.com/docs/a", "http://other.test/x"},
+		},
+		{
+			"with a base",
+			"http://example.com/docs/",
+			`<head><base href="https://cdn.example.com/v2/"></head><a href="a">a</a> <a href="/b">b</a>`,
+			[]string{"https://cdn.example.com/v2/a", "https://cdn.example.com/b"},
+		},
+		{
+			"not web pages",
+			"http://example.com/",
+			`<a href="mailto:someone@example.com">mail</a> <a href="javascript:void(0)">js</a> <a>no href</a>`,
+			nil,
+		},
+	}
+	c := NewCrawler(1, 1, 1)
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.page, nil)
+		resp := &http.Response{Request: req, Body: io.NopCloser(strings.NewReader(tt.body))}
+		var got []string
+		for _, link := range c.parse(resp) {
+			got = append(got, link.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: links %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnqueueKeepsTheRealURL(t *testing.T) {
+	c := NewCrawler(2, 1, 1)
+	for _, link := range []string{
+		"http://Example.com/docs/?utm_source=feed",
+		"http://example.com/docs",
+		"http://example.com:80/docs/",
+		"http://example.com/docs/a",
+	} {
+		u, _ := url.Parse(link)
+		c.enqueue(u, 2)
+	}
+	var got []string
+	for _, queued := range c.frontier {
+		got = append(got, queued.url)
+	}
+	want := []string{"http://Example.com/docs/?utm_source=feed", "http://example.com/docs/a"}
+	if !slices.Equal(got, want) {
+		t.Errorf("frontier %q, want %q", got, want)
+	}
+	if host := c.frontier[0].host; host != "example.com" {
+		t.Errorf("host %q, want example.com", host)
+	}
+}
+
+func TestCrawlFetchesDirectoryLinks(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/docs/" {
+			fmt.Fprint(w, `<a href="a">a</a> <a href="/docs">same page?</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	if err := NewCrawler(2, 2, 2).Start(context.Background(), srv.URL+"/docs/"); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(fetched)
+	if want := []string{"/docs/", "/docs/a"}; !slices.Equal(fetched, want) {
+		t.Errorf("fetched %q, want %q", fetched, want)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// `todo archive` moves todos completed long ago out of the list into an
+// archive file next to it, which keeps listings short. Archived todos keep
+// their IDs, can be searched with `todo archived` and put back with
+// `todo restore`; `todo purge` deletes them for good.
+
+// ArchivedTodo is a todo moved out of its list.
+type ArchivedTodo struct {
+	Todo
+	ArchivedAt time.Time
+}
+
+// Archive holds the archived todos of a list in the order they were
+// archived.
+type Archive struct {
+	Items []ArchivedTodo
+}
+
+// archiveSchema is the format of archive files, which were versioned from
+// the start.
+var archiveSchema = &Schema{
+	Version: 1,
+	Legacy:  func([]byte) int { return 1 },
+}
+
+func archiveFileName(fileName string) string {
+	return fileName + ".archive"
+}
+
+// openArchive returns the archive of the store in fileName. It is encrypted
+// along with the list.
+func openArchive(fileName string) *Storage[Archive] {
+	return &Storage[Archive]{FileName: archiveFileName(fileName), Secret: secret, Schema: archiveSchema}
+}
+
+// Archivable returns the IDs of the todos completed before cutoff. A todo
+// with subtasks is only archivable when all of its subtasks are, so open
+// subtasks never lose their parent.
+func (todos *Todos) Archivable(cutoff time.Time) []int {
+	old := func(t *Todo) bool {
+		return t.Completed && t.CompletedAt != nil && t.CompletedAt.Before(cutoff)
+	}
+	var ids []int
+	for i := range todos.Items {
+		t := &todos.Items[i]
+		if !old(t) {
+			continue
+		}
+		archivable := true
+		for _, id := range todos.descendants(t.ID) {
+			if d, _ := todos.Get(id); !old(d) {
+				archivable = false
+				break
+			}
+		}
+		if archivable {
+			ids = append(ids, t.ID)
+		}
+	}
+	return ids
+}
+
+// Remove takes the given todos out of the list and returns them, without
+// touching their subtasks or parents the way Delete does. Dependencies on
+// them are dropped.
+func (todos *Todos) Remove(ids []int) []Todo {
+	var removed []Todo
+	todos.Items = slices.DeleteFunc(todos.Items, func(t Todo) bool {
+		if slices.Contains(ids, t.ID) {
+			removed = append(removed, t)
+			return true
+		}
+		return false
+	})
+	todos.dropDependencies()
+	return removed
+}
+
+// Add appends todos to the archive, replacing earlier copies of the same
+// todos (which undoing an archive leaves behind).
+func (a *Archive) Add(items []Todo, now time.Time) {
+	for _, t := range items {
+		a.Items = slices.DeleteFunc(a.Items, func(old ArchivedTodo) bool {
+			return t.UID != "" && old.UID == t.UID
+		})
+		a.Items = append(a.Items, ArchivedTodo{Todo: t, ArchivedAt: now})
+	}
+}
+
+// Todos returns the archived todos as a list, for searching and printing.
+func (a *Archive) Todos() Todos {
+	todos := Todos{Items: make([]Todo, len(a.Items))}
+	for i, t := range a.Items {
+		todos.Items[i] = t.Todo
+	}
+	return todos
+}
+
+// Take removes the given archived todos, together with their archived
+// subtasks, from the archive and returns them.
+func (a *Archive) Take(ids []int) ([]Todo, error) {
+	all := a.Todos()
+	taking := make(map[int]bool)
+	for _, id := range ids {
+		if _, err := all.Get(id); err != nil {
+			return nil, fmt.Errorf("no archived todo with id %d", id)
+		}
+		taking[id] = true
+		for _, child := range all.descendants(id) {
+			taking[child] = true
+		}
+	}
+	var taken []Todo
+	a.Items = slices.DeleteFunc(a.Items, func(t ArchivedTodo) bool {
+		if taking[t.ID] {
+			taken = append(taken, t.Todo)
+			return true
+		}
+		return false
+	})
+	return taken, nil
+}
+
+// Purgeable returns the IDs of the archived todos completed before cutoff.
+func (a *Archive) Purgeable(cutoff time.Time) []int {
+	var ids []int
+	for _, t := range a.Items {
+		if t.CompletedAt == nil || t.CompletedAt.Before(cutoff) {
+			ids = append(ids, t.ID)
+		}
+	}
+	return ids
+}
+
+// Restore puts archived todos back into the list. They keep their IDs
+// unless another todo has taken one in the meantime. Todos already in the
+// list are skipped; Restore returns the IDs of the todos it put back.
+func (todos *Todos) Restore(items []Todo) []int {
+	todos.ensureIDs()
+	newIDs := make(map[int]int, len(items))
+	var restored []Todo
+	for _, t := range items {
+		if t.UID != "" && slices.ContainsFunc(todos.Items, func(existing Todo) bool { return existing.UID == t.UID }) {
+			continue
+		}
+		id := t.ID
+		if _, err := todos.indexOf(id); err == nil || id <= 0 {
+			id = todos.NextID
+			todos.NextID++
+		}
+		newIDs[t.ID] = id
+		restored = append(restored, t)
+	}
+	var ids []int
+	for _, t := range restored {
+		t.ID = newIDs[t.ID]
+		if parent, ok := newIDs[t.ParentID]; ok {
+			t.ParentID = parent
+		} else if _, err := todos.indexOf(t.ParentID); err != nil {
+			t.ParentID = 0
+		}
+		for i, dep := range t.DependsOn {
+			if newID, ok := newIDs[dep]; ok {
+				t.DependsOn[i] = newID
+			}
+		}
+		todos.Items = append(todos.Items, t)
+		ids = append(ids, t.ID)
+	}
+	todos.ensureIDs()
+	todos.dropDependencies()
+	return ids
+}
+
+// withArchive loads the archive of the list in fileName, lets fn change it
+// and saves it again under the archive's lock.
+func withArchive(fileName string, fn func(a *Archive) error) error {
+	storage := openArchive(fileName)
+	unlock, err := storage.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	var archive Archive
+	if err := storage.Load(&archive); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("loading the archive: %w", err)
+	}
+	if err := fn(&archive); err != nil {
+		return err
+	}
+	return storage.Save(archive)
+}
+
+// archiveTodos moves the todos completed more than days days ago from the
+// list in fileName into its archive and returns them.
+func archiveTodos(fileName string, todos *Todos, days int, now time.Time) ([]Todo, error) {
+	ids := todos.Archivable(now.AddDate(0, 0, -days))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var archived []Todo
+	err := withArchive(fileName, func(a *Archive) error {
+		archived = todos.Remove(ids)
+		a.Add(archived, now)
+		return nil
+	})
+	return archived, err
+}
+
+// autoArchiveDays returns the age from TODO_AUTO_ARCHIVE at which completed
+// todos are archived whenever a list is saved, or -1 when it isn't set.
+func autoArchiveDays() (int, error) {
+	value := os.Getenv("TODO_AUTO_ARCHIVE")
+	if value == "" {
+		return -1, nil
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return -1, fmt.Errorf("TODO_AUTO_ARCHIVE must be a number of days, not %q", value)
+	}
+	return days, nil
+}
+
+// autoArchive archives old completed todos before a local list is saved,
+// when TODO_AUTO_ARCHIVE is set.
+func autoArchive(todos *Todos) error {
+	days, err := autoArchiveDays()
+	if err != nil || days < 0 || options.Remote != "" {
+		return err
+	}
+	_, err = archiveTodos(options.File, todos, days, time.Now())
+	return err
+}
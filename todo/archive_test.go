@@ -0,0 +1,114 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestArchivable(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	old := now.AddDate(0, 0, -40)
+	recent := now.AddDate(0, 0, -5)
+	done := func(at time.Time) *time.Time { return &at }
+	todos := Todos{Items: []Todo{
+		{ID: 1, Title: "old", Completed: true, CompletedAt: done(old)},
+		{ID: 2, Title: "recent", Completed: true, CompletedAt: done(recent)},
+		{ID: 3, Title: "open"},
+		{ID: 4, Title: "old parent, open child", Completed: true, CompletedAt: done(old)},
+		{ID: 5, Title: "open child", ParentID: 4},
+		{ID: 6, Title: "old parent, old child", Completed: true, CompletedAt: done(old)},
+		{ID: 7, Title: "old child", ParentID: 6, Completed: true, CompletedAt: done(old)},
+		{ID: 8, Title: "old parent, recent grandchild", Completed: true, CompletedAt: done(old)},
+		{ID: 9, Title: "old child", ParentID: 8, Completed: true, CompletedAt: done(old)},
+		{ID: 10, Title: "recent grandchild", ParentID: 9, Completed: true, CompletedAt: done(recent)},
+		{ID: 11, Title: "completed without a time", Completed: true},
+	}}
+	tests := []struct {
+		days int
+		want []int
+	}{
+		{30, []int{1, 6, 7}},
+		{3, []int{1, 2, 6, 7, 8, 9, 10}},
+		{60, nil},
+	}
+	for _, tt := range tests {
+		if got := todos.Archivable(now.AddDate(0, 0, -tt.days)); !slices.Equal(got, tt.want) {
+			t.Errorf("archivable after %d days: %v, want %v", tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestArchiveAndRestore(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	var todos Todos
+	parent := todos.Add("Release 1.2")
+	child := todos.Add("Write notes")
+	todos.SetParent(child, parent)
+	review := todos.Add("Review")
+	deploy := todos.Add("Deploy")
+	todos.AddDependency(deploy, review)
+	keep := todos.Add("Keep me")
+
+	var archive Archive
+	removed := todos.Remove([]int{parent, child, review})
+	archive.Add(removed, now)
+	if got, _ := todos.Get(deploy); len(got.DependsOn) != 0 {
+		t.Errorf("deploy still depends on %v after review was archived", got.DependsOn)
+	}
+	// Archiving the same todos again, as undoing an archive leaves them
+	// behind, replaces the old copies.
+	archive.Add(removed, now)
+	if len(archive.Items) != 3 {
+		t.Errorf("archive holds %d todos, want 3", len(archive.Items))
+	}
+
+	// Another todo takes review's ID while it is archived.
+	todos.Items = append(todos.Items, Todo{ID: review, Title: "Squatter", UID: newUID()})
+
+	taken, err := archive.Take([]int{parent, review})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(taken) != 3 || len(archive.Items) != 0 {
+		t.Fatalf("took %d todos and left %d, want 3 and 0", len(taken), len(archive.Items))
+	}
+	ids := todos.Restore(taken)
+	if len(ids) != 3 {
+		t.Fatalf("restored %v, want 3 todos", ids)
+	}
+	byTitle := make(map[string]Todo)
+	for _, item := range todos.Items {
+		byTitle[item.Title] = item
+	}
+	if got := byTitle["Release 1.2"].ID; got != parent {
+		t.Errorf("the parent came back as %d, want its old ID %d", got, parent)
+	}
+	if got := byTitle["Write notes"]; got.ID != child || got.ParentID != parent {
+		t.Errorf("the subtask came back as %d under %d, want %d under %d", got.ID, got.ParentID, child, parent)
+	}
+	if got := byTitle["Review"].ID; got == review || got <= keep {
+		t.Errorf("review came back as %d, want a new ID as %d was taken", got, review)
+	}
+
+	// Restoring todos already in the list skips them.
+	if ids := todos.Restore(taken); len(ids) != 0 {
+		t.Errorf("restoring again put back %v", ids)
+	}
+	if _, err := archive.Take([]int{parent}); err == nil {
+		t.Error("took a todo that isn't archived")
+	}
+}
+
+func TestPurgeable(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	old, recent := now.AddDate(-1, 0, -1), now.AddDate(0, -1, 0)
+	archive := Archive{Items: []ArchivedTodo{
+		{Todo: Todo{ID: 1, Completed: true, CompletedAt: &old}},
+		{Todo: Todo{ID: 2, Completed: true, CompletedAt: &recent}},
+		{Todo: Todo{ID: 3, Completed: true}},
+	}}
+	if got := archive.Purgeable(now.AddDate(-1, 0, 0)); !slices.Equal(got, []int{1, 3}) {
+		t.Errorf("purgeable: %v, want [1 3]", got)
+	}
+}
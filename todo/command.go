@@ -1,58 +1,1710 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
-type CmdFlags struct {
-	Add    string
-	Del    int
-	Edit   string
-	Toggle int
-	List   bool
+// Command is a single `todo <name>` subcommand. Run gets the loaded todos and
+// the arguments after the command name; the list is only saved again when the
+// command is marked as Mutates and Run succeeds. The changes of a mutating
+// command are recorded for undo unless NoHistory is set. NoStore commands
+// manage storage themselves and get an empty list. NoAutoArchive keeps
+// TODO_AUTO_ARCHIVE from archiving todos after the command.
+type Command struct {
+	Name          string
+	Usage         string
+	Summary       string
+	Mutates       bool
+	NoHistory     bool
+	NoStore       bool
+	NoAutoArchive bool
+	Run           func(cmd *Command, todos *Todos, args []string) error
 }
 
-func NewCmdFlags() *CmdFlags {
-	cf := CmdFlags{}
+// usageError marks errors caused by bad input so main can exit with status 2.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, a ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, a...)}
+}
+
+var commands []*Command
+
+func init() {
+	commands = []*Command{
+		{
+			Name:    "add",
+			Usage:   "add [-due date] [-priority level] [-repeat rule] [-tag tag]... [-parent id] [-auto-complete] [-depends-on id]... [-no-parse] [-output format] <title>",
+			Summary: "Add a new todo",
+			Mutates: true,
+			Run:     runAdd,
+		},
+		{
+			Name:    "done",
+			Usage:   "done [-force] [-output format] <id>...",
+			Summary: "Mark one or more todos as completed",
+			Mutates: true,
+			Run:     runDone,
+		},
+		{
+			Name:    "reopen",
+			Usage:   "reopen [-output format] <id>...",
+			Summary: "Mark one or more completed todos as pending again",
+			Mutates: true,
+			Run:     runReopen,
+		},
+		{
+			Name:    "edit",
+			Usage:   "edit [-due date] [-priority level] [-repeat rule] [-tag tag]... [-untag tag]... [-parent id] [-auto-complete[=false]] [-depends-on id]... [-no-depends-on id]... [-output format] <id> [title]",
+			Summary: "Change the title, due date, priority, repeat rule, tags or parent of a todo",
+			Mutates: true,
+			Run:     runEdit,
+		},
+		{
+			Name:    "rm",
+			Usage:   "rm [-output format] <id>...",
+			Summary: "Delete one or more todos and their subtasks",
+			Mutates: true,
+			Run:     runRm,
+		},
+		{
+			Name:    "ls",
+			Usage:   "ls [-all] [-pending|-done|-actionable] [-tag tag]... [-priority level] [-due-before date] [-search text] [-sort key] [-reverse] [-output format] [-template text] [text]",
+			Summary: "List todos, optionally filtered, searched and sorted",
+			Run:     runLs,
+		},
+		{
+			Name:    "graph",
+			Usage:   "graph [-format text|dot] [-all]",
+			Summary: "Show which todos wait on which, as text or Graphviz DOT",
+			Run:     runGraph,
+		},
+		{
+			Name:          "archive",
+			Usage:         "archive [-days n] [-dry-run]",
+			Summary:       "Move todos completed long ago into the list's archive",
+			Mutates:       true,
+			NoAutoArchive: true,
+			Run:           runArchive,
+		},
+		{
+			Name:    "archived",
+			Usage:   "archived [-tag tag]... [-output format] [-template text] [text]",
+			Summary: "List or search the archived todos",
+			Run:     runArchived,
+		},
+		{
+			Name:          "restore",
+			Usage:         "restore <id>...",
+			Summary:       "Move archived todos back into the list",
+			Mutates:       true,
+			NoAutoArchive: true,
+			Run:           runRestore,
+		},
+		{
+			Name:    "purge",
+			Usage:   "purge [-days n] [-dry-run] [id]...",
+			Summary: "Delete archived todos for good",
+			NoStore: true,
+			Run:     runPurge,
+		},
+		{
+			Name:    "lists",
+			Usage:   "lists",
+			Summary: "Show the named lists and which one is current",
+			Run:     runLists,
+		},
+		{
+			Name:    "switch",
+			Usage:   "switch <list>",
+			Summary: "Make another named list the current one",
+			Run:     runSwitch,
+		},
+		{
+			// Undoing a move in one list would lose the todos or leave
+			// copies in the other, so moves aren't recorded for undo.
+			Name:      "mv",
+			Usage:     "mv <id>... <list>",
+			Summary:   "Move todos (with their subtasks) to another named list",
+			Mutates:   true,
+			NoHistory: true,
+			Run:       runMv,
+		},
+		{
+			Name:    "export",
+			Usage:   "export [-format md|csv|todotxt|json] [-o file]",
+			Summary: "Write the todos as Markdown, CSV, todo.txt or JSON",
+			Run:     runExport,
+		},
+		{
+			Name:    "import",
+			Usage:   "import [-format md|csv|todotxt|json] [file]",
+			Summary: "Add todos from a Markdown, CSV, todo.txt or JSON file, skipping duplicates",
+			Mutates: true,
+			Run:     runImport,
+		},
+		{
+			Name:      "undo",
+			Usage:     "undo [count]",
+			Summary:   "Undo the last change (or the last count changes)",
+			Mutates:   true,
+			NoHistory: true,
+			Run:       runUndo,
+		},
+		{
+			Name:      "redo",
+			Usage:     "redo [count]",
+			Summary:   "Redo the last undone change (or count of them)",
+			Mutates:   true,
+			NoHistory: true,
+			Run:       runRedo,
+		},
+		{
+			Name:    "tui",
+			Usage:   "tui",
+			Summary: "Browse and edit the list interactively",
+			NoStore: true,
+			Run:     runTUI,
+		},
+		{
+			Name:    "start",
+			Usage:   "start [-output format] <id>",
+			Summary: "Start the timer on a todo",
+			Mutates: true,
+			Run:     runStart,
+		},
+		{
+			Name:    "stop",
+			Usage:   "stop [-output format] [id]",
+			Summary: "Stop the running timer",
+			Mutates: true,
+			Run:     runStop,
+		},
+		{
+			Name:    "report",
+			Usage:   "report [-from date] [-to date] [-by item|tag|day] [-format table|csv] [-o file]",
+			Summary: "Sum the time tracked per todo, tag or day",
+			Run:     runReport,
+		},
+		{
+			Name:    "stats",
+			Usage:   "stats [-weeks n] [-oldest n]",
+			Summary: "Show completion counts, lead time, streak and a heatmap",
+			Run:     runStats,
+		},
+		{
+			Name:    "remind",
+			Usage:   "remind [-ahead 1h] [-every 1m] [-all] [-sink stdout|desktop|webhook|smtp]...",
+			Summary: "Send reminders for todos coming due or overdue",
+			NoStore: true,
+			Run:     runRemind,
+		},
+		{
+			Name:    "snooze",
+			Usage:   "snooze [-for 1h | -until time | -off] <id>...",
+			Summary: "Hold back reminders for todos",
+			Run:     runSnooze,
+		},
+		{
+			Name:    "serve",
+			Usage:   "serve [-addr host:port]",
+			Summary: "Serve the list over an HTTP/JSON API",
+			NoStore: true,
+			Run:     runServe,
+		},
+		{
+			Name:    "encrypt",
+			Usage:   "encrypt [-new-key-file path]",
+			Summary: "Encrypt the list and its undo history",
+			Run:     runEncrypt,
+		},
+		{
+			Name:    "decrypt",
+			Usage:   "decrypt",
+			Summary: "Store the list and its undo history as plain JSON again",
+			Run:     runDecrypt,
+		},
+		{
+			Name:    "rekey",
+			Usage:   "rekey [-new-key-file path]",
+			Summary: "Encrypt the list with a new passphrase or key file",
+			Run:     runRekey,
+		},
+		{
+			Name:    "keygen",
+			Usage:   "keygen <file>",
+			Summary: "Create a key file for encrypting lists",
+			NoStore: true,
+			Run:     runKeygen,
+		},
+		{
+			Name:    "migrate",
+			Usage:   "migrate -to backend [-file path] [-force]",
+			Summary: "Copy the todos into another storage backend",
+			Run:     runMigrate,
+		},
+		{
+			Name:    "sync",
+			Usage:   "sync [-repo dir] [-origin url]",
+			Summary: "Sync the list through a git repository",
+			Mutates: true,
+			Run:     runSync,
+		},
+		{
+			Name:    "help",
+			Usage:   "help [command]",
+			Summary: "Show help for todo or one of its commands",
+			Run:     runHelp,
+		},
+	}
+}
+
+func findCommand(name string) *Command {
+	for _, c := range commands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// flagSet returns a FlagSet for the command whose -h output shows the usage
+// line and summary before the flag defaults.
+func (cmd *Command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		cmd.printHelp(fs.Output())
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func (cmd *Command) printHelp(w io.Writer) {
+	fmt.Fprintf(w, "Usage: todo %s\n\n%s\n", cmd.Usage, cmd.Summary)
+}
+
+// parse parses the command's flags and returns the remaining arguments.
+// Flags may appear anywhere, so `todo add Buy milk -due tomorrow` works;
+// everything after "--" is treated as a plain argument.
+func (cmd *Command) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, &usageError{msg: err.Error()}
+		}
+		// fs.Parse stops at the first non-flag argument, or just after "--".
+		consumed := len(args) - len(fs.Args())
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(rest, fs.Args()...), nil
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return rest, nil
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+}
+
+// stringList is a flag that can be repeated and also splits on commas, as in
+// -tag work -tag urgent or -tag work,urgent.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: todo [-list name] [-store backend] [-file path] [-remote url] [-key-file path] <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Lists are kept in $TODO_DIR, $XDG_DATA_HOME/todo or ~/.local/share/todo.")
+	fmt.Fprintf(w, "Backends: %s (default json; also set by TODO_STORE)\n", strings.Join(backends, ", "))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.Name, c.Summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "todo help <command>" for more information about a command.`)
+}
+
+// parseIDs turns the given arguments into todo IDs and checks that every one
+// of them exists, so a command either applies to all of them or to none.
+func parseIDs(todos *Todos, args []string) ([]int, error) {
+	if len(args) == 0 {
+		return nil, usagef("at least one id is required")
+	}
+	ids := make([]int, 0, len(args))
+	seen := make(map[int]bool)
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, usagef("invalid id %q", arg)
+		}
+		if _, err := todos.indexOf(id); err != nil {
+			return nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// todoFields holds the optional fields shared by add and edit.
+type todoFields struct {
+	due      string
+	priority string
+	repeat   string
+	tags     stringList
+	parent   int
+	auto     bool
+	deps     stringList
+
+	setDue       bool
+	setPriority  bool
+	setRepeat    bool
+	setParent    bool
+	setAuto      bool
+	parsedDue    *time.Time
+	parsedPrio   Priority
+	parsedRepeat *Recurrence
+	parsedDeps   []int
+}
+
+const dueHelp = "due date: YYYY-MM-DD, YYYY-MM-DD HH:MM, today, tomorrow, a weekday or +Nd/+Nw/+Nm/+Ny"
+
+func (f *todoFields) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.due, "due", "", dueHelp+"; none clears it")
+	fs.StringVar(&f.priority, "priority", "", "priority: low, medium, high or none")
+	fs.StringVar(&f.priority, "p", "", "shorthand for -priority")
+	fs.StringVar(&f.repeat, "repeat", "", "repeat rule: daily, weekly on mon,thu, monthly on 15, every 3 days; none stops repeating")
+	fs.Var(&f.tags, "tag", "tag to add; may be repeated or comma separated")
+	fs.IntVar(&f.parent, "parent", 0, "make this a subtask of the todo with this id; 0 makes it top-level")
+	fs.BoolVar(&f.auto, "auto-complete", false, "complete this todo automatically once all its subtasks are done")
+	fs.Var(&f.deps, "depends-on", "id of a todo that must be completed first; may be repeated or comma separated")
+}
+
+// resolve validates the flags that were given, so a command can reject bad
+// input before it changes anything.
+func (f *todoFields) resolve(fs *flag.FlagSet) error {
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "due":
+			f.setDue = true
+		case "priority", "p":
+			f.setPriority = true
+		case "repeat":
+			f.setRepeat = true
+		case "parent":
+			f.setParent = true
+		case "auto-complete":
+			f.setAuto = true
+		}
+	})
+	if f.setDue {
+		if s := strings.ToLower(strings.TrimSpace(f.due)); s != "" && s != "none" {
+			t, err := ParseDue(s, time.Now())
+			if err != nil {
+				return usagef("%v", err)
+			}
+			f.parsedDue = &t
+		}
+	}
+	if f.setPriority {
+		p, err := ParsePriority(f.priority)
+		if err != nil {
+			return usagef("%v", err)
+		}
+		f.parsedPrio = p
+	}
+	if f.setRepeat {
+		if s := strings.ToLower(strings.TrimSpace(f.repeat)); s != "" && s != "none" {
+			r, err := ParseRecurrence(s)
+			if err != nil {
+				return usagef("%v", err)
+			}
+			f.parsedRepeat = r
+		}
+	}
+	var err error
+	if f.parsedDeps, err = parseIDList(f.deps); err != nil {
+		return usagef("-depends-on: %v", err)
+	}
+	return nil
+}
+
+// parseIDList parses the IDs given to a repeatable flag.
+func parseIDList(values []string) ([]int, error) {
+	var ids []int
+	for _, value := range values {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid id %q", value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// merge takes the fields read from a quick-add title. Fields also given as
+// flags keep the flag's value and are cleared from q, so the feedback only
+// shows what was used.
+func (f *todoFields) merge(q *QuickAdd) {
+	if f.setDue {
+		q.Due = nil
+	} else if q.Due != nil {
+		f.setDue, f.parsedDue = true, q.Due
+	}
+	if f.setPriority {
+		q.Priority = PriorityNone
+	} else if q.Priority != PriorityNone {
+		f.setPriority, f.parsedPrio = true, q.Priority
+	}
+	if f.setRepeat {
+		q.Repeat = nil
+	} else if q.Repeat != nil {
+		f.setRepeat, f.parsedRepeat = true, q.Repeat
+	}
+	f.tags = append(f.tags, q.Tags...)
+}
+
+// apply sets every field that was given on the command line on the todo.
+func (f *todoFields) apply(todos *Todos, id int) error {
+	if f.setDue {
+		if err := todos.SetDue(id, f.parsedDue); err != nil {
+			return err
+		}
+	}
+	if f.setPriority {
+		if err := todos.SetPriority(id, f.parsedPrio); err != nil {
+			return err
+		}
+	}
+	if f.setRepeat {
+		if err := todos.SetRepeat(id, f.parsedRepeat); err != nil {
+			return err
+		}
+	}
+	if f.setParent {
+		if err := todos.SetParent(id, f.parent); err != nil {
+			return err
+		}
+	}
+	if f.setAuto {
+		if err := todos.SetAutoComplete(id, f.auto); err != nil {
+			return err
+		}
+	}
+	for _, dep := range f.parsedDeps {
+		if err := todos.AddDependency(id, dep); err != nil {
+			return err
+		}
+	}
+	return todos.AddTags(id, f.tags...)
+}
+
+func runAdd(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	var fields todoFields
+	var out outputOptions
+	fields.register(fs)
+	noParse := fs.Bool("no-parse", false, "keep the title as typed instead of reading a due date, #tags, !priority and repeat rule from it")
+	out.register(fs)
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := out.check(); err != nil {
+		return err
+	}
+	title := strings.TrimSpace(strings.Join(args, " "))
+	if title == "" {
+		return usagef("a title is required")
+	}
+	if err := fields.resolve(fs); err != nil {
+		return err
+	}
+	var parsed string
+	if !*noParse {
+		quick := ParseQuickAdd(title, time.Now())
+		if quick.Title == "" {
+			return usagef("%q has nothing left for a title; use -no-parse to keep it as typed", title)
+		}
+		if quick.Found() {
+			title = quick.Title
+			fields.merge(&quick)
+			parsed = ": " + quick.String()
+		}
+	}
+	id := todos.Add(title)
+	if err := fields.apply(todos, id); err != nil {
+		return err
+	}
+	return echoTodos(&out, todos, []int{id}, fmt.Sprintf("Added todo %d%s", id, parsed))
+}
+
+// echoTodos prints the given todos in the requested output format, or msg
+// when no format was requested.
+func echoTodos(out *outputOptions, todos *Todos, ids []int, msg string) error {
+	var items []Todo
+	for _, id := range ids {
+		if t, err := todos.Get(id); err == nil {
+			items = append(items, *t)
+		}
+	}
+	if echoed, err := out.echo(items); echoed || err != nil {
+		return err
+	}
+	if msg != "" {
+		fmt.Println(msg)
+	}
+	return nil
+}
+
+func runDone(cmd *Command, todos *Todos, args []string) error {
+	return setCompleted(cmd, todos, args, true)
+}
+
+func runReopen(cmd *Command, todos *Todos, args []string) error {
+	return setCompleted(cmd, todos, args, false)
+}
+
+func setCompleted(cmd *Command, todos *Todos, args []string, completed bool) error {
+	fs := cmd.flagSet()
+	var out outputOptions
+	var force bool
+	if completed {
+		fs.BoolVar(&force, "force", false, "complete todos even if they wait on open todos")
+	}
+	out.register(fs)
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := out.check(); err != nil {
+		return err
+	}
+	ids, err := parseIDs(todos, args)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		index, _ := todos.indexOf(id)
+		if todos.Items[index].Completed == completed {
+			continue
+		}
+		if completed && !force {
+			if err := todos.checkBlocked(id); err != nil {
+				return fmt.Errorf("%w; use -force to complete it anyway", err)
+			}
+		}
+		if err := todos.Toggle(id); err != nil {
+			return err
+		}
+	}
+	return echoTodos(&out, todos, ids, "")
+}
+
+func runEdit(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	var fields todoFields
+	var untag, undep stringList
+	var out outputOptions
+	fields.register(fs)
+	fs.Var(&untag, "untag", "tag to remove; may be repeated or comma separated")
+	fs.Var(&undep, "no-depends-on", "id of a todo to stop depending on; may be repeated or comma separated")
+	out.register(fs)
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := out.check(); err != nil {
+		return err
+	}
+	// The output flags only say how to print the todo; something must change.
+	changes := 0
+	fs.Visit(func(fl *flag.Flag) {
+		if fl.Name != "output" && fl.Name != "template" {
+			changes++
+		}
+	})
+	if len(args) == 0 || (len(args) == 1 && changes == 0) {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	ids, err := parseIDs(todos, args[:1])
+	if err != nil {
+		return err
+	}
+	id := ids[0]
+
+	if err := fields.resolve(fs); err != nil {
+		return err
+	}
+	undeps, err := parseIDList(undep)
+	if err != nil {
+		return usagef("-no-depends-on: %v", err)
+	}
+	if len(args) > 1 {
+		title := strings.TrimSpace(strings.Join(args[1:], " "))
+		if title == "" {
+			return usagef("a title is required")
+		}
+		if err := todos.Edit(id, title); err != nil {
+			return err
+		}
+	}
+	if err := fields.apply(todos, id); err != nil {
+		return err
+	}
+	if err := todos.RemoveTags(id, untag...); err != nil {
+		return err
+	}
+	for _, dep := range undeps {
+		if err := todos.RemoveDependency(id, dep); err != nil {
+			return err
+		}
+	}
+	return echoTodos(&out, todos, ids, "")
+}
+
+func runRm(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	var out outputOptions
+	out.register(fs)
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := out.check(); err != nil {
+		return err
+	}
+	ids, err := parseIDs(todos, args)
+	if err != nil {
+		return err
+	}
+	// Echo what is about to go, including subtasks deleted along with it.
+	removed := cloneTodos(*todos)
+	for _, id := range ids {
+		// An earlier id may have been the parent of this one.
+		if _, err := todos.Get(id); err != nil {
+			continue
+		}
+		if err := todos.Delete(id); err != nil {
+			return err
+		}
+	}
+	var gone []int
+	for _, t := range removed.Items {
+		if _, err := todos.Get(t.ID); err != nil {
+			gone = append(gone, t.ID)
+		}
+	}
+	return echoTodos(&out, &removed, gone, "")
+}
+
+func runLs(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	var q Query
+	var tags, priorities stringList
+	var dueBefore string
+	fs.BoolVar(&q.Pending, "pending", false, "only show todos that are not completed")
+	fs.BoolVar(&q.Done, "done", false, "only show completed todos")
+	fs.BoolVar(&q.Actionable, "actionable", false, "only show open todos that don't wait on other open todos")
+	fs.Var(&tags, "tag", "only show todos with this tag; may be repeated")
+	fs.Var(&priorities, "priority", "only show todos with one of these priorities, e.g. high,medium")
+	fs.StringVar(&dueBefore, "due-before", "", "only show todos due before this date ("+dueHelp+")")
+	fs.StringVar(&q.Search, "search", "", "only show todos whose title contains every word")
+	fs.StringVar(&q.SortBy, "sort", "created", "sort by "+strings.Join(sortKeys, ", "))
+	fs.BoolVar(&q.Reverse, "reverse", false, "reverse the sort order")
+	all := fs.Bool("all", false, "show every named list")
+	var out outputOptions
+	out.register(fs)
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := out.check(); err != nil {
+		return err
+	}
+
+	if q.Pending && q.Done {
+		return usagef("-pending and -done cannot be used together")
+	}
+	if q.Actionable && q.Done {
+		return usagef("-actionable and -done cannot be used together")
+	}
+	// Any remaining arguments are search words, so `todo ls milk` works.
+	q.Search = strings.TrimSpace(q.Search + " " + strings.Join(args, " "))
+	q.Tags = tags
+	for _, name := range priorities {
+		p, err := ParsePriority(name)
+		if err != nil {
+			return usagef("%v", err)
+		}
+		q.Priorities = append(q.Priorities, p)
+	}
+	if dueBefore != "" {
+		t, err := ParseDue(dueBefore, time.Now())
+		if err != nil {
+			return usagef("%v", err)
+		}
+		q.DueBefore = &t
+	}
+
+	if *all {
+		if out.custom() {
+			return usagef("-all only supports table output")
+		}
+		return printAllLists(q)
+	}
+	result, err := todos.Query(q)
+	if err != nil {
+		return usagef("%v", err)
+	}
+	return out.write(os.Stdout, &result)
+}
+
+func runGraph(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	format := fs.String("format", "text", "text or dot")
+	all := fs.Bool("all", false, "include todos without dependencies")
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	switch *format {
+	case "text":
+		writeGraphText(os.Stdout, todos, *all)
+	case "dot":
+		writeGraphDOT(os.Stdout, todos, *all)
+	default:
+		return usagef("unknown format %q (use text, dot)", *format)
+	}
+	return nil
+}
+
+func runArchive(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	days := fs.Int("days", 30, "archive todos completed more than this many days ago")
+	dryRun := fs.Bool("dry-run", false, "only show what would be archived")
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if *days < 0 {
+		return usagef("-days can't be negative")
+	}
+	if options.Remote != "" {
+		return usagef("archive needs a local list; run it where the server runs")
+	}
+	now := time.Now()
+	if *dryRun {
+		ids := todos.Archivable(now.AddDate(0, 0, -*days))
+		fmt.Printf("Would archive %s completed more than %s ago:\n", plural(len(ids), "todo"), plural(*days, "day"))
+		for _, id := range ids {
+			t, _ := todos.Get(id)
+			fmt.Println(plainLine(*t))
+		}
+		return nil
+	}
+	archived, err := archiveTodos(options.File, todos, *days, now)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Archived %s completed more than %s ago\n", plural(len(archived), "todo"), plural(*days, "day"))
+	return nil
+}
+
+// loadArchive reads the archive of the current list.
+func loadArchive() (Archive, error) {
+	var archive Archive
+	if options.Remote != "" {
+		return archive, usagef("the archive is only available for local lists")
+	}
+	err := openArchive(options.File).Load(&archive)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return archive, err
+	}
+	return archive, nil
+}
+
+func runArchived(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	var q Query
+	var tags stringList
+	fs.Var(&tags, "tag", "only show todos with this tag; may be repeated")
+	var out outputOptions
+	out.register(fs)
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := out.check(); err != nil {
+		return err
+	}
+	q.Search = strings.Join(args, " ")
+	q.Tags = tags
+	archive, err := loadArchive()
+	if err != nil {
+		return err
+	}
+	all := archive.Todos()
+	result, err := all.Query(q)
+	if err != nil {
+		return err
+	}
+	return out.write(os.Stdout, &result)
+}
+
+func runRestore(cmd *Command, todos *Todos, args []string) error {
+	args, err := cmd.parse(cmd.flagSet(), args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if options.Remote != "" {
+		return usagef("restore needs a local list; run it where the server runs")
+	}
+	ids, err := parseIDList(args)
+	if err != nil {
+		return usagef("%v", err)
+	}
+	var taken []Todo
+	var restored []int
+	err = withArchive(options.File, func(a *Archive) error {
+		if taken, err = a.Take(ids); err != nil {
+			return err
+		}
+		restored = todos.Restore(taken)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(restored) > 0 {
+		fmt.Printf("Restored %s: %s\n", plural(len(restored), "todo"), formatIDs(restored))
+	}
+	if skipped := len(taken) - len(restored); skipped > 0 {
+		fmt.Printf("Removed %s from the archive that were already in the list\n", plural(skipped, "todo"))
+	}
+	return nil
+}
+
+func runPurge(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	days := fs.Int("days", 0, "only delete archived todos completed more than this many days ago")
+	dryRun := fs.Bool("dry-run", false, "only show what would be deleted")
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *days < 0 {
+		return usagef("-days can't be negative")
+	}
+	if options.Remote != "" {
+		return usagef("purge needs a local list; run it where the server runs")
+	}
+	ids, err := parseIDList(args)
+	if err != nil {
+		return usagef("%v", err)
+	}
+
+	var purged []Todo
+	purge := func(a *Archive) error {
+		if len(ids) == 0 {
+			ids = a.Purgeable(time.Now().AddDate(0, 0, -*days))
+		}
+		taken, err := a.Take(ids)
+		purged = taken
+		return err
+	}
+	verb := "Deleted"
+	if *dryRun {
+		verb = "Would delete"
+		archive, err := loadArchive()
+		if err != nil {
+			return err
+		}
+		err = purge(&archive)
+	} else {
+		err = withArchive(options.File, purge)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s %s for good\n", verb, plural(len(purged), "archived todo"))
+	for _, t := range purged {
+		fmt.Println(plainLine(t))
+	}
+	return nil
+}
+
+func printAllLists(q Query) error {
+	if err := options.requireLists(); err != nil {
+		return err
+	}
+	names, err := listNames(options.Dir, options.Store)
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		todos, err := loadList(name)
+		if err != nil {
+			return err
+		}
+		result, err := todos.Query(q)
+		if err != nil {
+			return usagef("%v", err)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s (%d)\n", name, len(result.Items))
+		result.Print()
+	}
+	return nil
+}
+
+// loadList reads a named list without locking it, for display only.
+func loadList(name string) (Todos, error) {
+	todos := Todos{}
+	store, err := openStore(options.Store, listFile(options.Dir, name, options.Store))
+	if err != nil {
+		return todos, err
+	}
+	if err := store.Load(&todos); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return todos, fmt.Errorf("loading list %s: %w", name, err)
+	}
+	return todos, nil
+}
+
+func runLists(cmd *Command, todos *Todos, args []string) error {
+	args, err := cmd.parse(cmd.flagSet(), args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return usagef("lists takes no arguments")
+	}
+	if err := options.requireLists(); err != nil {
+		return err
+	}
+	names, err := listNames(options.Dir, options.Store)
+	if err != nil {
+		return err
+	}
+	current := currentList(options.Dir)
+	if !slices.Contains(names, current) {
+		names = append(names, current)
+		slices.Sort(names)
+	}
+	for _, name := range names {
+		list, err := loadList(name)
+		if err != nil {
+			return err
+		}
+		pending := 0
+		for _, t := range list.Items {
+			if !t.Completed {
+				pending++
+			}
+		}
+		marker := " "
+		if name == current {
+			marker = "*"
+		}
+		fmt.Printf("%s %-20s %d pending, %d total\n", marker, name, pending, len(list.Items))
+	}
+	return nil
+}
+
+func runSwitch(cmd *Command, todos *Todos, args []string) error {
+	args, err := cmd.parse(cmd.flagSet(), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if err := options.requireLists(); err != nil {
+		return err
+	}
+	if err := validateListName(args[0]); err != nil {
+		return usagef("%v", err)
+	}
+	if err := setCurrentList(options.Dir, args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Switched to list %s\n", args[0])
+	return nil
+}
+
+func runMv(cmd *Command, todos *Todos, args []string) error {
+	args, err := cmd.parse(cmd.flagSet(), args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if err := options.requireLists(); err != nil {
+		return err
+	}
+	target := args[len(args)-1]
+	if err := validateListName(target); err != nil {
+		return usagef("%v", err)
+	}
+	if target == options.List {
+		return usagef("the todos are already in list %s", target)
+	}
+	ids, err := parseIDs(todos, args[:len(args)-1])
+	if err != nil {
+		return err
+	}
+
+	before := cloneTodos(*todos)
+	taken, err := todos.Take(ids)
+	if err != nil {
+		return err
+	}
+	// This list is saved before the target, and put back if the target
+	// can't be saved, so a failed move leaves the todos where they were
+	// instead of in both lists.
+	var newIDs map[int]int
+	saved := false
+	err = withList(target, func(list *Todos) error {
+		newIDs = list.Insert(taken)
+		if err := currentStore.Save(*todos); err != nil {
+			return fmt.Errorf("saving todos: %w", err)
+		}
+		saved = true
+		return nil
+	})
+	if err != nil && saved {
+		if restoreErr := currentStore.Save(before); restoreErr != nil {
+			return fmt.Errorf("%w; putting the todos back also failed: %v", err, restoreErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for _, t := range taken {
+		fmt.Printf("Moved todo %d to %s as %d\n", t.ID, target, newIDs[t.ID])
+	}
+	return nil
+}
+
+func runExport(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	format := fs.String("format", "", "output format: "+strings.Join(formats, ", ")+"; defaults to the -o extension or md")
+	out := fs.String("o", "", "write to this file instead of standard output")
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if *format == "" {
+		*format = formatFromFileName(*out)
+	}
+	if *format == "" {
+		*format = "md"
+	}
+	if !slices.Contains(formats, *format) {
+		return usagef("unknown format %q (use %s)", *format, strings.Join(formats, ", "))
+	}
+
+	if *out == "" {
+		return todos.Export(os.Stdout, *format)
+	}
+	var buf bytes.Buffer
+	if err := todos.Export(&buf, *format); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(*out, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d todos to %s\n", len(todos.Items), *out)
+	return nil
+}
+
+func runImport(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	format := fs.String("format", "", "input format: "+strings.Join(formats, ", ")+"; defaults to the file extension")
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+
+	in := io.Reader(os.Stdin)
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+		if *format == "" {
+			*format = formatFromFileName(args[0])
+		}
+	}
+	if *format == "" {
+		return usagef("-format is required when it can't be told from the file name")
+	}
+	if !slices.Contains(formats, *format) {
+		return usagef("unknown format %q (use %s)", *format, strings.Join(formats, ", "))
+	}
+
+	items, err := ParseTodos(in, *format)
+	if err != nil {
+		return err
+	}
+	added, skipped := todos.Import(items)
+	fmt.Printf("Imported %d todos, skipped %d duplicates\n", added, skipped)
+	return nil
+}
+
+func runUndo(cmd *Command, todos *Todos, args []string) error {
+	return stepHistory(cmd, todos, args, history.Undo, "Undid")
+}
+
+func runRedo(cmd *Command, todos *Todos, args []string) error {
+	return stepHistory(cmd, todos, args, history.Redo, "Redid")
+}
+
+func stepHistory(cmd *Command, todos *Todos, args []string, step func(*Todos) (HistoryEntry, error), verb string) error {
+	args, err := cmd.parse(cmd.flagSet(), args)
+	if err != nil {
+		return err
+	}
+	if options.Remote != "" {
+		return errors.New("undo and redo only work on the server's own list")
+	}
+	count := 1
+	if len(args) > 1 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if len(args) == 1 {
+		if count, err = strconv.Atoi(args[0]); err != nil || count < 1 {
+			return usagef("invalid count %q", args[0])
+		}
+	}
+	for i := 0; i < count; i++ {
+		entry, err := step(todos)
+		if err != nil {
+			if i > 0 {
+				// Keep the steps that worked; they are saved as usual.
+				fmt.Fprintf(os.Stderr, "todo %s: stopped after %d step(s): %v\n", cmd.Name, i, err)
+				return nil
+			}
+			return err
+		}
+		fmt.Printf("%s %s\n", verb, entry)
+	}
+	return nil
+}
+
+func runStart(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	var out outputOptions
+	out.register(fs)
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := out.check(); err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	ids, err := parseIDs(todos, args)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	stopped, err := todos.Start(ids[0], now)
+	if err != nil {
+		return err
+	}
+	var msg strings.Builder
+	for _, id := range stopped {
+		t, _ := todos.Get(id)
+		fmt.Fprintf(&msg, "Stopped the timer on todo %d after %s\n", id, formatDuration(now.Sub(t.Sessions[len(t.Sessions)-1].Start)))
+	}
+	fmt.Fprintf(&msg, "Started the timer on todo %d", ids[0])
+	return echoTodos(&out, todos, append(stopped, ids[0]), msg.String())
+}
+
+func runStop(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	var out outputOptions
+	out.register(fs)
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := out.check(); err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	ids := todos.Running()
+	if len(args) == 1 {
+		if ids, err = parseIDs(todos, args); err != nil {
+			return err
+		}
+	} else if len(ids) == 0 {
+		return errors.New("no timer is running")
+	}
+	now := time.Now()
+	var msg []string
+	for _, id := range ids {
+		d, err := todos.Stop(id, now)
+		if err != nil {
+			return err
+		}
+		t, _ := todos.Get(id)
+		msg = append(msg, fmt.Sprintf("Stopped the timer on todo %d after %s (%s in total)", id, formatDuration(d), formatDuration(t.Tracked(now))))
+	}
+	return echoTodos(&out, todos, ids, strings.Join(msg, "\n"))
+}
+
+func runReport(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	fromFlag := fs.String("from", "-6d", "first day of the report")
+	toFlag := fs.String("to", "today", "last day of the report")
+	by := fs.String("by", "item", "group by "+strings.Join(reportGroups, ", "))
+	format := fs.String("format", "", "table or csv; defaults to the -o extension or table")
+	out := fs.String("o", "", "write to this file instead of standard output")
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if *format == "" {
+		*format = "table"
+		if strings.EqualFold(filepath.Ext(*out), ".csv") {
+			*format = "csv"
+		}
+	}
+	if *format != "table" && *format != "csv" {
+		return usagef("unknown format %q (use table, csv)", *format)
+	}
+	now := time.Now()
+	from, to, err := parseReportRange(*fromFlag, *toFlag, now)
+	if err != nil {
+		return usagef("%v", err)
+	}
+	rows, err := todos.Report(from, to, now, *by)
+	if err != nil {
+		return usagef("%v", err)
+	}
+	if err := writeReport(*out, *format, rows, *by); err != nil {
+		return err
+	}
+	if *out != "" {
+		fmt.Printf("Wrote a report of %d row(s) to %s\n", len(rows), *out)
+	}
+	return nil
+}
+
+func runStats(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	weeks := fs.Int("weeks", 12, "weeks covered by the charts")
+	oldest := fs.Int("oldest", 5, "how many of the oldest open todos to show")
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if *weeks < 1 || *weeks > 104 {
+		return usagef("-weeks must be between 1 and 104")
+	}
+	if *oldest < 0 {
+		return usagef("-oldest can't be negative")
+	}
+	now := time.Now()
+	printStats(os.Stdout, todos.Stats(now, *oldest), now, *weeks)
+	return nil
+}
+
+func runRemind(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	ahead := fs.Duration("ahead", time.Hour, "remind this long before a todo is due")
+	every := fs.Duration("every", 0, "keep running and scan this often (default: scan once)")
+	all := fs.Bool("all", false, "scan every named list")
+	var sinkOpts sinkOptions
+	sinkOpts.register(fs)
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if options.Remote != "" {
+		return usagef("remind needs a local list; run it where the server runs")
+	}
+	sinks, err := sinkOpts.open()
+	if err != nil {
+		return usagef("%v", err)
+	}
+	targets, err := remindTargets(*all)
+	if err != nil {
+		return err
+	}
+
+	scan := func() error {
+		var errs []error
+		for _, target := range targets {
+			errs = append(errs, remindList(target.Name, target.File, sinks, *ahead))
+		}
+		return errors.Join(errs...)
+	}
+	if *every <= 0 {
+		return scan()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+	for {
+		// A failed scan is reported and retried; the daemon keeps running.
+		if err := scan(); err != nil {
+			fmt.Fprintf(os.Stderr, "todo %s: %v\n", cmd.Name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func runSnooze(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	duration := fs.Duration("for", time.Hour, "snooze for this long")
+	until := fs.String("until", "", "snooze until this time (same forms as -due)")
+	off := fs.Bool("off", false, "cancel the snooze")
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if options.Remote != "" {
+		return usagef("snooze needs a local list; run it where the server runs")
+	}
+	ids, err := parseIDs(todos, args)
+	if err != nil {
+		return err
+	}
+	end := time.Now().Add(*duration)
+	if *until != "" {
+		if end, err = ParseDue(*until, time.Now()); err != nil {
+			return usagef("%v", err)
+		}
+	}
+
+	stateStorage := NewStorage[ReminderState](remindersFileName(options.File))
+	var state ReminderState
+	if err := stateStorage.Load(&state); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, id := range ids {
+		if *off {
+			state.Unsnooze(id)
+			fmt.Printf("Todo %d is no longer snoozed\n", id)
+		} else {
+			state.Snooze(id, end)
+			fmt.Printf("Snoozed todo %d until %s\n", id, end.Format("Mon, 02 Jan 2006 15:04"))
+		}
+	}
+	return stateStorage.Save(state)
+}
+
+func runServe(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if options.Remote != "" {
+		return usagef("serve can't be used with -remote")
+	}
+	store, err := openStore(options.Store, options.File)
+	if err != nil {
+		return usagef("%v", err)
+	}
+	server := &Server{Store: store, History: openHistory(options.File)}
+	// Load once before serving, so an encrypted list asks for its
+	// passphrase now rather than in the middle of a request.
+	if _, err := viewList(store); err != nil {
+		return err
+	}
+	fmt.Printf("Serving %s on http://%s\n", options.File, *addr)
+	return http.ListenAndServe(*addr, server.Handler())
+}
+
+func runEncrypt(cmd *Command, todos *Todos, args []string) error {
+	return changeEncryption(cmd, args, "encrypt")
+}
+
+func runDecrypt(cmd *Command, todos *Todos, args []string) error {
+	return changeEncryption(cmd, args, "decrypt")
+}
+
+func runRekey(cmd *Command, todos *Todos, args []string) error {
+	return changeEncryption(cmd, args, "rekey")
+}
 
-	flag.StringVar(&cf.Add, "add", "", "Add a new todo by giving the title")
-	flag.StringVar(&cf.Edit, "edit", "", "Edit a todo by index and giving new title. id:new_title")
-	flag.IntVar(&cf.Del, "del", -1, "Delete a todo by index")
-	flag.IntVar(&cf.Toggle, "toggle", -1, "Toggle a todo by index")
-	flag.BoolVar(&cf.List, "list", false, "List all todo")
+// changeEncryption rewrites the list and its history with the encryption
+// the command asks for. main has already loaded the list, so the current
+// secret is known to work, and holds the lock.
+func changeEncryption(cmd *Command, args []string, action string) error {
+	fs := cmd.flagSet()
+	var keyFile string
+	if action != "decrypt" {
+		fs.StringVar(&keyFile, "new-key-file", "", "encrypt with this key file instead of a passphrase (see `todo keygen`)")
+	}
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if options.Remote != "" {
+		return usagef("%s works on local lists; run it where the server runs", action)
+	}
+	if backend, _ := normalizeBackend(options.Store); backend != "json" {
+		return fmt.Errorf("only the json store can be encrypted, not %s", backend)
+	}
+	encrypted := isEncrypted(options.File)
+	switch {
+	case action == "encrypt" && encrypted:
+		return errors.New("the list is already encrypted; use `todo rekey` to change the key")
+	case action != "encrypt" && !encrypted:
+		return errors.New("the list isn't encrypted")
+	}
+
+	var to *Secret
+	if action == "encrypt" && keyFile == "" && secret.configured() {
+		// Encrypt with the passphrase or key file already given.
+		to = &Secret{Passphrase: secret.Passphrase, KeyFile: secret.KeyFile}
+	} else if action != "decrypt" {
+		if to, err = newSecret(keyFile, "TODO_NEW_PASSPHRASE"); err != nil {
+			return err
+		}
+	}
+
+	list := &Storage[Todos]{FileName: options.File, Secret: secret, Schema: todoSchema}
+	if err := list.Rekey(to); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := openHistory(options.File).Rekey(to); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	switch action {
+	case "encrypt":
+		fmt.Printf("Encrypted %s\n", options.File)
+	case "decrypt":
+		fmt.Printf("Decrypted %s\n", options.File)
+	default:
+		fmt.Printf("Changed the key of %s\n", options.File)
+	}
+	return nil
+}
+
+func runKeygen(cmd *Command, todos *Todos, args []string) error {
+	args, err := cmd.parse(cmd.flagSet(), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if err := writeKeyFile(args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Created %s. Keep a copy somewhere safe: without it the lists it encrypts can't be read.\n", args[0])
+	return nil
+}
+
+func runMigrate(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	var to, file string
+	var force bool
+	fs.StringVar(&to, "to", "", "backend to copy into: "+strings.Join(backends, ", "))
+	fs.StringVar(&file, "file", "", "file for the new backend; defaults to the same list in that backend")
+	fs.BoolVar(&force, "force", false, "replace todos already stored in the target")
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 || to == "" {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+
+	to, err = normalizeBackend(to)
+	if err != nil {
+		return usagef("%v", err)
+	}
+	if file == "" {
+		if options.Dir == "" {
+			return usagef("-file is required when migrating a store given with -file")
+		}
+		file = listFile(options.Dir, options.List, to)
+	}
+	if file == options.File {
+		return fmt.Errorf("%s is already the current store", file)
+	}
+	if to != "json" && isEncrypted(options.File) {
+		return fmt.Errorf("the %s store can't be encrypted; run `todo decrypt` first to store the list unencrypted", to)
+	}
+	target, err := openStore(to, file)
+	if err != nil {
+		return usagef("%v", err)
+	}
+
+	unlock, err := target.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	flag.Parse()
-	return &cf
+	existing := Todos{}
+	if err := target.Load(&existing); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading %s: %w", file, err)
+	}
+	if len(existing.Items) > 0 && !force {
+		return fmt.Errorf("%s already holds %d todos; use -force to replace them", file, len(existing.Items))
+	}
+	if err := target.Save(*todos); err != nil {
+		return fmt.Errorf("writing %s: %w", file, err)
+	}
+	fmt.Printf("Copied %d todos into %s. Use it with -store %s or TODO_STORE=%s.\n", len(todos.Items), file, to, to)
+	return nil
 }
 
-func (cf *CmdFlags) Execute(todos *Todos) {
+func runSync(cmd *Command, todos *Todos, args []string) error {
+	fs := cmd.flagSet()
+	repo := fs.String("repo", os.Getenv("TODO_SYNC_REPO"), "git repository to sync through (env TODO_SYNC_REPO; default: sync in the data directory)")
+	origin := fs.String("origin", "", "set the remote to pull from and push to, such as a bare repository")
+	args, err := cmd.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	if options.Remote != "" {
+		return usagef("sync needs a local list; run it where the server runs")
+	}
+	if isEncrypted(options.File) {
+		return errors.New("the list is encrypted and sync would store it in plain text")
+	}
+	list := options.List
+	if options.Dir == "" {
+		if *repo == "" {
+			return usagef("-repo is required when syncing a store given with -file")
+		}
+		list = strings.TrimSuffix(filepath.Base(options.File), filepath.Ext(options.File))
+	}
+	if *repo == "" {
+		*repo = filepath.Join(options.Dir, "sync")
+	}
+
+	g, err := openGitRepo(*repo)
+	if err != nil {
+		return err
+	}
+	result, err := gitSync(g, list, todos, *origin)
+	if err != nil {
+		return err
+	}
+	for _, note := range result.Merged {
+		fmt.Println(note)
+	}
 	switch {
-	case cf.List:
-		todos.Print()
-	case cf.Add != "":
-		todos.Add(cf.Add)
-	case cf.Edit != "":
-		parts := strings.SplitN(cf.Edit, ":", 2)
-		if len(parts) != 2 {
-			fmt.Println("Error, invalid format for edit. Please use id:new_title")
-			os.Exit(1)
-		}
-		index, err := strconv.Atoi(parts[0])
-
-		if err != nil {
-			fmt.Println("Error. Invalid index")
-			os.Exit(1)
-		}
-		todos.Edit(index, parts[1])
-	case cf.Toggle != -1:
-		todos.Toggle(cf.Toggle)
-	case cf.Del != -1:
-		todos.Delete(cf.Del)
+	case result.NoRemote && result.Committed:
+		fmt.Printf("Committed %s to %s; set a remote with -origin to share it\n", list, *repo)
+	case result.NoRemote:
+		fmt.Printf("Nothing to commit in %s; set a remote with -origin to share it\n", *repo)
 	default:
-		println("Invalid command")
+		fmt.Printf("Synced %s: %d added, %d changed, %d removed\n", list, result.Added, result.Changed, result.Removed)
+	}
+	return nil
+}
+
+func runHelp(cmd *Command, todos *Todos, args []string) error {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return nil
+	}
+	c := findCommand(args[0])
+	if c == nil {
+		return usagef("unknown command %q", args[0])
+	}
+	if c == cmd {
+		// help has no flags, so it can't be run with -h like the others.
+		cmd.printHelp(os.Stdout)
+		return nil
 	}
+	// Every command prints its own usage and flags when given -h.
+	return c.Run(c, todos, []string{"-h"})
 }
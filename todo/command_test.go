@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// runTodo runs a todo command line against the lists in $TODO_DIR and
+// returns its exit code and everything it printed.
+func runTodo(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	out, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = out, out
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	options, history, currentStore = globalOptions{}, &History{}, nil
+	code := run(args)
+	data, _ := os.ReadFile(out.Name())
+	return code, string(data)
+}
+
+// useTestDir points the named lists at an empty directory for one test.
+func useTestDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, env := range []string{"TODO_STORE", "TODO_FILE", "TODO_LIST", "TODO_REMOTE", "TODO_KEY_FILE", "TODO_PASSPHRASE", "TODO_AUTO_ARCHIVE"} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("TODO_DIR", dir)
+	return dir
+}
+
+func TestExitCodes(t *testing.T) {
+	useTestDir(t)
+	if code, out := runTodo(t, "add", "Buy milk"); code != 0 {
+		t.Fatalf("add: exit code %d\n%s", code, out)
+	}
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{nil, 2},
+		{[]string{"frobnicate"}, 2},
+		{[]string{"-nope", "ls"}, 2},
+		{[]string{"-h"}, 0},
+		{[]string{"ls"}, 0},
+		{[]string{"ls", "-nope"}, 2},
+		{[]string{"ls", "-h"}, 0},
+		{[]string{"add"}, 2},
+		{[]string{"add", "-priority", "urgent", "Call mum"}, 2},
+		{[]string{"done"}, 2},
+		{[]string{"done", "one"}, 2},
+		{[]string{"done", "9"}, 1},
+		{[]string{"rm", "1", "9"}, 1},
+		{[]string{"help"}, 0},
+		{[]string{"help", "add"}, 0},
+		{[]string{"help", "help"}, 0},
+		{[]string{"help", "frobnicate"}, 2},
+		{[]string{"edit"}, 2},
+		{[]string{"edit", "1"}, 2},
+		{[]string{"edit", "1", "-output", "json"}, 2},
+		{[]string{"edit", "1", "-output", "json", "-template", "{{.Title}}"}, 2},
+		{[]string{"edit", "9", "Buy cream"}, 1},
+		{[]string{"edit", "1", "-priority", "high", "-output", "json"}, 0},
+		{[]string{"edit", "1", "Buy oat milk"}, 0},
+	}
+	for _, tt := range tests {
+		if code, out := runTodo(t, tt.args...); code != tt.code {
+			t.Errorf("todo %q: exit code %d, want %d\n%s", tt.args, code, tt.code, out)
+		}
+	}
+}
+
+func TestFlagsAnywhere(t *testing.T) {
+	useTestDir(t)
+	tests := []struct {
+		args  []string
+		title string
+	}{
+		{[]string{"add", "-priority", "high", "Buy", "milk"}, "Buy milk"},
+		{[]string{"add", "Buy", "milk", "-priority", "high"}, "Buy milk"},
+		{[]string{"add", "-priority", "high", "--", "-5", "degrees", "-priority"}, "-5 degrees -priority"},
+	}
+	for i, tt := range tests {
+		if code, out := runTodo(t, tt.args...); code != 0 {
+			t.Fatalf("todo %q: exit code %d\n%s", tt.args, code, out)
+		}
+		todos, err := loadList(defaultList)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := todos.Items[i]
+		if got.Title != tt.title || got.Priority != PriorityHigh {
+			t.Errorf("todo %q added %q with priority %v, want %q with high", tt.args, got.Title, got.Priority, tt.title)
+		}
+	}
+}
+
+func TestEditWithoutChangesKeepsTheList(t *testing.T) {
+	dir := useTestDir(t)
+	runTodo(t, "add", "Buy milk")
+	file := filepath.Join(dir, defaultList+".json")
+	before, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, out := runTodo(t, "edit", "1", "-output", "json"); code != 2 || out == "" {
+		t.Errorf("edit without changes: exit code %d and output %q, want 2 and the usage", code, out)
+	}
+	if after, _ := os.ReadFile(file); string(after) != string(before) {
+		t.Error("edit without changes rewrote the list")
+	}
+}
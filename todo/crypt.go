@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// An encrypted file is a small JSON envelope around the plain file sealed
+// with AES-256-GCM. The key comes from a passphrase stretched with scrypt or
+// from a key file, either one mixed with the random salt in the envelope.
+
+const encryptedFormat = "todo-encrypted/v1"
+
+// scrypt cost for new files; files keep the cost they were written with.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var (
+	ErrEncrypted = errors.New("the file is encrypted; set TODO_PASSPHRASE or TODO_KEY_FILE")
+	ErrDecrypt   = errors.New("can't decrypt: wrong passphrase or key file, or the file is damaged")
+)
+
+type encryptedFile struct {
+	Format string `json:"format"`
+	KDF    string `json:"kdf"` // "scrypt" or "keyfile"
+	Salt   []byte `json:"salt"`
+	N      int    `json:"n,omitempty"`
+	R      int    `json:"r,omitempty"`
+	P      int    `json:"p,omitempty"`
+	Nonce  []byte `json:"nonce"`
+	Data   []byte `json:"data"`
+}
+
+// parseEncrypted returns the envelope when data is an encrypted file.
+func parseEncrypted(data []byte) (*encryptedFile, bool) {
+	if !bytes.Contains(data, []byte(encryptedFormat)) {
+		return nil, false
+	}
+	var env encryptedFile
+	if json.Unmarshal(data, &env) != nil || env.Format != encryptedFormat {
+		return nil, false
+	}
+	return &env, true
+}
+
+// isEncrypted reports whether the file exists and is encrypted.
+func isEncrypted(name string) bool {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return false
+	}
+	_, ok := parseEncrypted(data)
+	return ok
+}
+
+// Secret unlocks encrypted files: a passphrase or a key file. With Prompt
+// set and neither given, it asks for the passphrase on the terminal the
+// first time it is needed.
+type Secret struct {
+	Passphrase string
+	KeyFile    string
+	Prompt     bool
+
+	keys map[string][]byte // derived keys by KDF and salt
+}
+
+// secret is the Secret from TODO_PASSPHRASE, TODO_KEY_FILE and -key-file.
+var secret *Secret
+
+// configured reports whether new files should be encrypted: a passphrase or
+// key file was given, or the user typed one in.
+func (s *Secret) configured() bool {
+	return s != nil && (s.Passphrase != "" || s.KeyFile != "")
+}
+
+// material returns the KDF to use and the secret bytes it takes.
+func (s *Secret) material() (string, []byte, error) {
+	if s == nil {
+		return "", nil, ErrEncrypted
+	}
+	if s.KeyFile != "" {
+		data, err := os.ReadFile(s.KeyFile)
+		if err != nil {
+			return "", nil, fmt.Errorf("reading the key file: %w", err)
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) < 32 {
+			return "", nil, fmt.Errorf("key file %s is too short; create one with `todo keygen`", s.KeyFile)
+		}
+		return "keyfile", data, nil
+	}
+	if s.Passphrase == "" && s.Prompt {
+		passphrase, err := readPassphrase("Passphrase: ")
+		if err != nil {
+			return "", nil, err
+		}
+		s.Passphrase = passphrase
+	}
+	if s.Passphrase == "" {
+		return "", nil, ErrEncrypted
+	}
+	return "scrypt", []byte(s.Passphrase), nil
+}
+
+// key derives the AES key for an envelope.
+func (s *Secret) key(env *encryptedFile) ([]byte, error) {
+	kdf, material, err := s.material()
+	if err != nil {
+		return nil, err
+	}
+	if kdf != env.KDF {
+		if env.KDF == "keyfile" {
+			return nil, fmt.Errorf("%w (it was encrypted with a key file)", ErrDecrypt)
+		}
+		return nil, fmt.Errorf("%w (it was encrypted with a passphrase)", ErrDecrypt)
+	}
+	id := env.KDF + "/" + hex.EncodeToString(env.Salt)
+	if key, ok := s.keys[id]; ok {
+		return key, nil
+	}
+
+	var key []byte
+	switch kdf {
+	case "scrypt":
+		// Bound the cost so a tampered file can't exhaust memory.
+		if env.N > 1<<20 || env.R*env.P > 64 {
+			return nil, fmt.Errorf("%w (scrypt parameters out of range)", ErrDecrypt)
+		}
+		if key, err = scrypt.Key(material, env.Salt, env.N, env.R, env.P, 32); err != nil {
+			return nil, fmt.Errorf("%w (%v)", ErrDecrypt, err)
+		}
+	case "keyfile":
+		sum := sha256.Sum256(append(append([]byte{}, env.Salt...), material...))
+		key = sum[:]
+	}
+	if s.keys == nil {
+		s.keys = make(map[string][]byte)
+	}
+	s.keys[id] = key
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plain. It reuses the salt of prev, the envelope being
+// replaced, when the KDF is the same, so the key isn't derived again.
+func (s *Secret) seal(plain []byte, prev *encryptedFile) ([]byte, error) {
+	kdf, _, err := s.material()
+	if err != nil {
+		return nil, err
+	}
+	env := encryptedFile{Format: encryptedFormat, KDF: kdf}
+	if prev != nil && prev.KDF == kdf {
+		env.Salt, env.N, env.R, env.P = prev.Salt, prev.N, prev.R, prev.P
+	} else {
+		env.Salt = make([]byte, 16)
+		if _, err := rand.Read(env.Salt); err != nil {
+			return nil, err
+		}
+		if kdf == "scrypt" {
+			env.N, env.R, env.P = scryptN, scryptR, scryptP
+		}
+	}
+	key, err := s.key(&env)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	env.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return nil, err
+	}
+	env.Data = gcm.Seal(nil, env.Nonce, plain, []byte(encryptedFormat))
+	return json.MarshalIndent(env, "", "    ")
+}
+
+// open decrypts an envelope.
+func (s *Secret) open(env *encryptedFile) ([]byte, error) {
+	key, err := s.key(env)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plain, err := gcm.Open(nil, env.Nonce, env.Data, []byte(encryptedFormat))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+// readPassphrase asks for a passphrase on the terminal without echoing it.
+func readPassphrase(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", ErrEncrypted
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	data, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// newSecret returns the secret to encrypt with: the key file if one is
+// given, else the passphrase from env, else one typed in twice.
+func newSecret(keyFile, env string) (*Secret, error) {
+	if keyFile != "" {
+		s := &Secret{KeyFile: keyFile}
+		_, _, err := s.material()
+		return s, err
+	}
+	if passphrase := os.Getenv(env); passphrase != "" {
+		return &Secret{Passphrase: passphrase}, nil
+	}
+	passphrase, err := readPassphrase("New passphrase: ")
+	if errors.Is(err, ErrEncrypted) {
+		return nil, fmt.Errorf("no terminal to ask for the new passphrase; set %s or use a key file", env)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, errors.New("the passphrase can't be empty")
+	}
+	again, err := readPassphrase("Repeat it: ")
+	if err != nil {
+		return nil, err
+	}
+	if again != passphrase {
+		return nil, errors.New("the passphrases don't match")
+	}
+	return &Secret{Passphrase: passphrase}, nil
+}
+
+// writeKeyFile creates a key file with 32 random bytes, hex encoded.
+func writeKeyFile(name string) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, hex.EncodeToString(key)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "todo.key")
+	if err := writeKeyFile(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	otherKey := filepath.Join(t.TempDir(), "other.key")
+	if err := writeKeyFile(otherKey); err != nil {
+		t.Fatal(err)
+	}
+	passphrase := &Secret{Passphrase: "correct horse"}
+	key := &Secret{KeyFile: keyFile}
+
+	tests := []struct {
+		name string
+		seal *Secret
+		open *Secret
+		want error // nil when open must succeed
+	}{
+		{"passphrase", passphrase, &Secret{Passphrase: "correct horse"}, nil},
+		{"key file", key, &Secret{KeyFile: keyFile}, nil},
+		{"wrong passphrase", passphrase, &Secret{Passphrase: "battery staple"}, ErrDecrypt},
+		{"wrong key file", key, &Secret{KeyFile: otherKey}, ErrDecrypt},
+		{"key file for a passphrase", passphrase, key, ErrDecrypt},
+		{"passphrase for a key file", key, passphrase, ErrDecrypt},
+		{"no secret", passphrase, nil, ErrEncrypted},
+	}
+	plain := []byte(`{"version":3,"data":{"NextID":2,"Items":[{"ID":1,"Title":"secret plans"}]}}`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := tt.seal.seal(plain, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(sealed, []byte("secret plans")) {
+				t.Fatal("the sealed file contains the plain text")
+			}
+			env, ok := parseEncrypted(sealed)
+			if !ok {
+				t.Fatal("parseEncrypted doesn't recognise a sealed file")
+			}
+			got, err := tt.open.open(env)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Errorf("open: got %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("open = %q, %v; want the sealed text", got, err)
+			}
+		})
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	s := &Secret{Passphrase: "correct horse"}
+	sealed, err := s.seal([]byte("secret plans"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, _ := parseEncrypted(sealed)
+	env.Data[0] ^= 1
+	if _, err := s.open(env); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("open of a tampered file: got %v, want ErrDecrypt", err)
+	}
+}
+
+func TestSaveRefusesFileItCantDecrypt(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "todos.json")
+	owner := &Storage[Todos]{FileName: file, Secret: &Secret{Passphrase: "correct horse"}, Schema: todoSchema}
+	var todos Todos
+	todos.Add("secret plans")
+	if err := owner.Save(todos); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(before, []byte("secret plans")) {
+		t.Fatal("the saved file contains the plain text")
+	}
+
+	for name, s := range map[string]*Secret{"wrong passphrase": {Passphrase: "battery staple"}, "no secret": nil} {
+		other := &Storage[Todos]{FileName: file, Secret: s, Schema: todoSchema}
+		var loaded Todos
+		if err := other.Load(&loaded); err == nil {
+			t.Errorf("%s: Load succeeded", name)
+		}
+		if err := other.Save(Todos{}); err == nil {
+			t.Errorf("%s: Save overwrote a file it can't decrypt", name)
+		}
+		after, _ := os.ReadFile(file)
+		if !bytes.Equal(before, after) {
+			t.Fatalf("%s: the file changed", name)
+		}
+	}
+
+	var loaded Todos
+	if err := owner.Load(&loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Items) != 1 || loaded.Items[0].Title != "secret plans" {
+		t.Errorf("loaded %+v, want the saved todo", loaded.Items)
+	}
+}
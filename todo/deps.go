@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A todo can depend on other todos in the same list: it is blocked until
+// all of them are completed. Dependencies never form a cycle, as nothing in
+// a cycle could ever be done.
+
+// ErrBlocked is returned when completing a todo that still waits on others.
+var ErrBlocked = errors.New("blocked")
+
+// AddDependency makes id depend on the todo on, so id is blocked until on
+// is completed.
+func (todos *Todos) AddDependency(id, on int) error {
+	t, err := todos.Get(id)
+	if err != nil {
+		return err
+	}
+	if _, err := todos.Get(on); err != nil {
+		return err
+	}
+	if id == on {
+		return fmt.Errorf("todo %d can't depend on itself", id)
+	}
+	if path := todos.dependencyPath(on, id); path != nil {
+		return fmt.Errorf("todo %d can't depend on %d: that would make a cycle (%s)", id, on, formatCycle(append([]int{id}, path...)))
+	}
+	if !slices.Contains(t.DependsOn, on) {
+		t.DependsOn = append(t.DependsOn, on)
+	}
+	return nil
+}
+
+// RemoveDependency makes id no longer depend on the todo on.
+func (todos *Todos) RemoveDependency(id, on int) error {
+	t, err := todos.Get(id)
+	if err != nil {
+		return err
+	}
+	t.DependsOn = slices.DeleteFunc(t.DependsOn, func(dep int) bool { return dep == on })
+	if len(t.DependsOn) == 0 {
+		t.DependsOn = nil
+	}
+	return nil
+}
+
+// dependencyPath returns the todos from one todo to another following
+// dependencies, both ends included, or nil when to can't be reached.
+func (todos *Todos) dependencyPath(from, to int) []int {
+	seen := make(map[int]bool)
+	var walk func(id int) []int
+	walk = func(id int) []int {
+		if id == to {
+			return []int{id}
+		}
+		if seen[id] {
+			return nil
+		}
+		seen[id] = true
+		t, err := todos.Get(id)
+		if err != nil {
+			return nil
+		}
+		for _, dep := range t.DependsOn {
+			if path := walk(dep); path != nil {
+				return append([]int{id}, path...)
+			}
+		}
+		return nil
+	}
+	return walk(from)
+}
+
+func formatCycle(ids []int) string {
+	return joinIDs(ids, " → ")
+}
+
+// formatIDs lists IDs as "3, 5".
+func formatIDs(ids []int) string {
+	return joinIDs(ids, ", ")
+}
+
+func joinIDs(ids []int, sep string) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, sep)
+}
+
+// Blockers returns the IDs of the open todos id depends on.
+func (todos *Todos) Blockers(id int) []int {
+	t, err := todos.Get(id)
+	if err != nil {
+		return nil
+	}
+	var ids []int
+	for _, dep := range t.DependsOn {
+		if d, err := todos.Get(dep); err == nil && !d.Completed {
+			ids = append(ids, dep)
+		}
+	}
+	return ids
+}
+
+// Actionable reports whether a todo can be worked on now: it is open and
+// not blocked.
+func (todos *Todos) Actionable(id int) bool {
+	t, err := todos.Get(id)
+	return err == nil && !t.Completed && len(todos.Blockers(id)) == 0
+}
+
+// checkBlocked fails with ErrBlocked when id depends on open todos.
+func (todos *Todos) checkBlocked(id int) error {
+	blockers := todos.Blockers(id)
+	if len(blockers) == 0 {
+		return nil
+	}
+	names := make([]string, len(blockers))
+	for i, dep := range blockers {
+		d, _ := todos.Get(dep)
+		names[i] = fmt.Sprintf("%d (%s)", dep, d.Title)
+	}
+	return fmt.Errorf("todo %d is %w by %s", id, ErrBlocked, strings.Join(names, ", "))
+}
+
+// dropDependencies removes every dependency on todos that are gone.
+func (todos *Todos) dropDependencies() {
+	for i := range todos.Items {
+		t := &todos.Items[i]
+		t.DependsOn = slices.DeleteFunc(t.DependsOn, func(dep int) bool {
+			_, err := todos.indexOf(dep)
+			return err != nil
+		})
+		if len(t.DependsOn) == 0 {
+			t.DependsOn = nil
+		}
+	}
+}
+
+// graphTodos returns the todos that depend on others or that others depend
+// on, in list order, or every todo with all set.
+func (todos *Todos) graphTodos(all bool) []Todo {
+	needed := make(map[int]bool)
+	for _, t := range todos.Items {
+		for _, dep := range t.DependsOn {
+			needed[dep] = true
+		}
+	}
+	var items []Todo
+	for _, t := range todos.Items {
+		if all || len(t.DependsOn) > 0 || needed[t.ID] {
+			items = append(items, t)
+		}
+	}
+	return items
+}
+
+// writeGraphText draws each todo nothing depends on as a tree of what it
+// waits on. A todo shared by several trees is drawn in each of them.
+func writeGraphText(w io.Writer, todos *Todos, all bool) {
+	items := todos.graphTodos(all)
+	needed := make(map[int]bool)
+	for _, t := range items {
+		for _, dep := range t.DependsOn {
+			needed[dep] = true
+		}
+	}
+	label := func(t *Todo) string {
+		s := strconv.Itoa(t.ID) + " " + t.Title
+		switch {
+		case t.Completed:
+			s += " ✓"
+		case len(todos.Blockers(t.ID)) > 0:
+			s += " (blocked)"
+		}
+		return s
+	}
+	var draw func(id int, prefix string, path []int)
+	draw = func(id int, prefix string, path []int) {
+		t, _ := todos.Get(id)
+		for i, dep := range t.DependsOn {
+			d, err := todos.Get(dep)
+			if err != nil {
+				continue
+			}
+			branch, next := "├── ", "│   "
+			if i == len(t.DependsOn)-1 {
+				branch, next = "└── ", "    "
+			}
+			// Lists merged by sync can hold a cycle; don't follow it around.
+			if slices.Contains(path, dep) {
+				fmt.Fprintf(w, "%s%s%s ↻ cycle\n", prefix, branch, label(d))
+				continue
+			}
+			fmt.Fprintf(w, "%s%s%s\n", prefix, branch, label(d))
+			draw(dep, prefix+next, append(path, dep))
+		}
+	}
+	drawn := false
+	for _, t := range items {
+		if needed[t.ID] {
+			continue
+		}
+		fmt.Fprintln(w, label(&t))
+		draw(t.ID, "", []int{t.ID})
+		drawn = true
+	}
+	// Report cycles too: todos caught in one may have no root to start from.
+	inCycle := make(map[int]bool)
+	for _, t := range items {
+		if inCycle[t.ID] {
+			continue
+		}
+		if path := todos.cycleFrom(t.ID); path != nil {
+			for _, id := range path {
+				inCycle[id] = true
+			}
+			fmt.Fprintf(w, "cycle: %s\n", formatCycle(path))
+			drawn = true
+		}
+	}
+	if !drawn {
+		fmt.Fprintln(w, "No todos depend on others.")
+	}
+}
+
+// cycleFrom returns a cycle through id, such as 3 → 5 → 3, or nil.
+func (todos *Todos) cycleFrom(id int) []int {
+	t, err := todos.Get(id)
+	if err != nil {
+		return nil
+	}
+	for _, dep := range t.DependsOn {
+		if path := todos.dependencyPath(dep, id); path != nil {
+			return append([]int{id}, path...)
+		}
+	}
+	return nil
+}
+
+// writeGraphDOT writes the graph for Graphviz, with an edge from each todo
+// to the todos that wait on it, so arrows point in the order work is done.
+func writeGraphDOT(w io.Writer, todos *Todos, all bool) {
+	fmt.Fprintln(w, "digraph todos {")
+	fmt.Fprintln(w, "\trankdir=LR;")
+	fmt.Fprintln(w, "\tnode [shape=box];")
+	items := todos.graphTodos(all)
+	for _, t := range items {
+		attrs := fmt.Sprintf("label=%q", strconv.Itoa(t.ID)+" "+t.Title)
+		switch {
+		case t.Completed:
+			attrs += ", style=filled, fillcolor=lightgray"
+		case len(todos.Blockers(t.ID)) > 0:
+			attrs += ", color=red"
+		}
+		fmt.Fprintf(w, "\tt%d [%s];\n", t.ID, attrs)
+	}
+	for _, t := range items {
+		for _, dep := range t.DependsOn {
+			if _, err := todos.Get(dep); err == nil {
+				fmt.Fprintf(w, "\tt%d -> t%d;\n", dep, t.ID)
+			}
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAddDependency(t *testing.T) {
+	// 3 waits on 2, which waits on 1.
+	chain := func() Todos {
+		var todos Todos
+		for _, title := range []string{"Design", "Build", "Ship", "Announce"} {
+			todos.Add(title)
+		}
+		todos.AddDependency(2, 1)
+		todos.AddDependency(3, 2)
+		return todos
+	}
+	tests := []struct {
+		name    string
+		id, on  int
+		wantErr string // "" when the dependency is added
+		deps    []int  // what id depends on afterwards
+	}{
+		{"new dependency", 4, 3, "", []int{3}},
+		{"second dependency", 3, 1, "", []int{2, 1}},
+		{"already there", 3, 2, "", []int{2}},
+		{"on itself", 1, 1, "itself", nil},
+		{"direct cycle", 1, 2, "cycle (1 → 2 → 1)", nil},
+		{"transitive cycle", 1, 3, "cycle (1 → 3 → 2 → 1)", nil},
+		{"missing todo", 1, 9, "no todo", nil},
+		{"missing dependent", 9, 1, "no todo", nil},
+	}
+	for _, tt := range tests {
+		todos := chain()
+		err := todos.AddDependency(tt.id, tt.on)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: got error %v, want one mentioning %q", tt.name, err, tt.wantErr)
+		}
+		if got, err := todos.Get(tt.id); err == nil && !slices.Equal(got.DependsOn, tt.deps) {
+			t.Errorf("%s: todo %d depends on %v, want %v", tt.name, tt.id, got.DependsOn, tt.deps)
+		}
+	}
+}
+
+func TestBlockers(t *testing.T) {
+	var todos Todos
+	design := todos.Add("Design")
+	review := todos.Add("Review")
+	build := todos.Add("Build")
+	todos.AddDependency(build, design)
+	todos.AddDependency(build, review)
+
+	if got := todos.Blockers(build); !slices.Equal(got, []int{design, review}) {
+		t.Errorf("blockers %v, want [%d %d]", got, design, review)
+	}
+	if err := todos.checkBlocked(build); !errors.Is(err, ErrBlocked) {
+		t.Errorf("checkBlocked: got %v, want ErrBlocked", err)
+	}
+	if todos.Actionable(build) || !todos.Actionable(design) {
+		t.Error("a blocked todo is actionable or an unblocked one isn't")
+	}
+	todos.Toggle(design)
+	if got := todos.Blockers(build); !slices.Equal(got, []int{review}) {
+		t.Errorf("blockers after completing design %v, want [%d]", got, review)
+	}
+	todos.Toggle(review)
+	if err := todos.checkBlocked(build); err != nil || !todos.Actionable(build) {
+		t.Errorf("build is still blocked once everything it waits on is done: %v", err)
+	}
+}
+
+func TestDoneBlocked(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+		done bool
+	}{
+		{"blocked", []string{"done", "2"}, 1, false},
+		{"forced", []string{"done", "-force", "2"}, 0, true},
+		{"blocker first", []string{"done", "1", "2"}, 0, true},
+		{"blocked first", []string{"done", "2", "1"}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDir(t)
+			runTodo(t, "add", "Design")
+			runTodo(t, "add", "-depends-on", "1", "Build")
+			if code, out := runTodo(t, tt.args...); code != tt.code {
+				t.Errorf("todo %q: exit code %d, want %d\n%s", tt.args, code, tt.code, out)
+			}
+			todos, _ := loadList(defaultList)
+			if build, err := todos.Get(2); err != nil || build.Completed != tt.done {
+				t.Errorf("build completed: %v (%v), want %v", build.Completed, err, tt.done)
+			}
+		})
+	}
+}
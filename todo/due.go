@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dueLayouts = []string{
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// ParseDue turns user input into a due time relative to now. It accepts
+// absolute dates ("2025-03-01", "2025-03-01 17:00"), the words "today",
+// "tomorrow" and weekday names (the next such day), and offsets such as
+// "+3d", "+2w", "+1m" or "+1y". Dates without a time of day are due at midnight,
+// which is treated as "any time that day".
+func ParseDue(s string, now time.Time) (time.Time, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	today := startOfDay(now)
+
+	switch s {
+	case "today":
+		return today, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if s == name || s == name[:3] {
+			diff := (int(day) - int(today.Weekday()) + 7) % 7
+			if diff == 0 {
+				diff = 7
+			}
+			return today.AddDate(0, 0, diff), nil
+		}
+	}
+
+	if strings.HasPrefix(s, "+") && len(s) > 2 {
+		n, err := strconv.Atoi(s[1 : len(s)-1])
+		if err == nil && n >= 0 {
+			switch s[len(s)-1] {
+			case 'd':
+				return today.AddDate(0, 0, n), nil
+			case 'w':
+				return today.AddDate(0, 0, 7*n), nil
+			case 'm':
+				return today.AddDate(0, n, 0), nil
+			case 'y':
+				return today.AddDate(n, 0, 0), nil
+			}
+		}
+	}
+
+	for _, layout := range dueLayouts {
+		// s was lower-cased above, which turns the T of "2025-03-01T17:00" into a t.
+		if t, err := time.ParseInLocation(layout, strings.ToUpper(s), now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid due date %q (use YYYY-MM-DD, today, tomorrow, a weekday or +Nd/+Nw/+Nm/+Ny)", s)
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// allDay reports whether a due time has no time of day attached.
+func allDay(t time.Time) bool {
+	return t.Equal(startOfDay(t))
+}
+
+// IsOverdue reports whether a pending todo is past its due time. Todos due
+// on a whole day only become overdue once that day is over.
+func (t *Todo) IsOverdue(now time.Time) bool {
+	if t.Completed || t.Due == nil {
+		return false
+	}
+	due := *t.Due
+	if allDay(due) {
+		due = due.AddDate(0, 0, 1)
+	}
+	return now.After(due) || now.Equal(due)
+}
+
+func formatDue(due time.Time) string {
+	if allDay(due) {
+		return due.Format("Mon, 02 Jan 2006")
+	}
+	return due.Format("Mon, 02 Jan 2006 15:04")
+}
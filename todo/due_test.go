@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDue(t *testing.T) {
+	// A Wednesday afternoon.
+	now := time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC)
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2026, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"today", day(10, 14)},
+		{"Tomorrow", day(10, 15)},
+		{" friday ", day(10, 16)},
+		{"sun", day(10, 18)},
+		{"wednesday", day(10, 21)}, // the next one, not today
+		{"+0d", day(10, 14)},
+		{"+3d", day(10, 17)},
+		{"+2w", day(10, 28)},
+		{"+1m", day(11, 14)},
+		{"+1y", time.Date(2027, 10, 14, 0, 0, 0, 0, time.UTC)},
+		{"2026-12-01", day(12, 1)},
+		{"2026-12-01 17:45", time.Date(2026, 12, 1, 17, 45, 0, 0, time.UTC)},
+		{"2026-12-01T09:00", time.Date(2026, 12, 1, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseDue(tt.in, now)
+		if err != nil {
+			t.Errorf("ParseDue(%q): %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseDue(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDueInvalid(t *testing.T) {
+	now := time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC)
+	for _, in := range []string{"", "soon", "+d", "+3x", "+-3d", "-3d", "yesterday", "2026-13-01", "we"} {
+		got, err := ParseDue(in, now)
+		if err == nil {
+			t.Errorf("ParseDue(%q) = %v, want an error", in, got)
+		} else if !strings.Contains(err.Error(), "+Nd/+Nw/+Nm/+Ny") {
+			t.Errorf("ParseDue(%q): %q doesn't list every offset", in, err)
+		}
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Priority
+	}{
+		{"", PriorityNone},
+		{"none", PriorityNone},
+		{"L", PriorityLow},
+		{"med", PriorityMedium},
+		{"2", PriorityMedium},
+		{"high", PriorityHigh},
+	}
+	for _, tt := range tests {
+		got, err := ParsePriority(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePriority(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := ParsePriority("urgent"); err == nil {
+		t.Error("ParsePriority(\"urgent\") succeeded")
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats understood by `todo export` and `todo import`.
+var formats = []string{"md", "csv", "todotxt", "json"}
+
+// formatFromFileName guesses a format from a file extension.
+func formatFromFileName(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown":
+		return "md"
+	case ".csv":
+		return "csv"
+	case ".txt":
+		return "todotxt"
+	case ".json":
+		return "json"
+	}
+	return ""
+}
+
+// Export writes the todos in the given format.
+func (todos *Todos) Export(w io.Writer, format string) error {
+	switch format {
+	case "md":
+		return exportMarkdown(w, todos)
+	case "csv":
+		return exportCSV(w, todos)
+	case "todotxt":
+		return exportTodoTxt(w, todos)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		return enc.Encode(todos.Items)
+	}
+	return fmt.Errorf("unknown format %q (use %s)", format, strings.Join(formats, ", "))
+}
+
+// ParseTodos reads todos in the given format. IDs in the input are only
+// used to link subtasks to their parents; Insert gives them new ones.
+func ParseTodos(r io.Reader, format string) ([]Todo, error) {
+	switch format {
+	case "md":
+		return parseMarkdown(r)
+	case "csv":
+		return parseCSV(r)
+	case "todotxt":
+		return parseTodoTxt(r)
+	case "json":
+		var todos Todos
+		if err := json.NewDecoder(r).Decode(&todos); err != nil {
+			return nil, err
+		}
+		return todos.Items, nil
+	}
+	return nil, fmt.Errorf("unknown format %q (use %s)", format, strings.Join(formats, ", "))
+}
+
+// Import adds the todos that aren't in the list yet and returns how many
+// were added and how many were skipped as duplicates. A todo is a duplicate
+// when one with the same title and due day already exists.
+func (todos *Todos) Import(items []Todo) (added, skipped int) {
+	seen := make(map[string]bool, len(todos.Items))
+	for _, t := range todos.Items {
+		seen[duplicateKey(t)] = true
+	}
+	var fresh []Todo
+	for _, t := range items {
+		key := duplicateKey(t)
+		if seen[key] || strings.TrimSpace(t.Title) == "" {
+			skipped++
+			continue
+		}
+		seen[key] = true
+		fresh = append(fresh, t)
+	}
+	todos.Insert(fresh)
+	return len(fresh), skipped
+}
+
+func duplicateKey(t Todo) string {
+	key := strings.ToLower(strings.Join(strings.Fields(t.Title), " "))
+	if t.Due != nil {
+		key += "\x00" + t.Due.Format(time.DateOnly)
+	}
+	return key
+}
+
+// exportMarkdown writes a GitHub task list. Subtasks are indented under
+// their parent and the other fields follow the title as tokens, as in
+// "- [ ] Release 1.2 !high due:2025-03-01T17:00 #work".
+func exportMarkdown(w io.Writer, todos *Todos) error {
+	for _, row := range todos.Tree() {
+		t := row.Todo
+		box := " "
+		if t.Completed {
+			box = "x"
+		}
+		line := fmt.Sprintf("%s- [%s] %s%s", strings.Repeat("  ", row.Depth), box, t.Title, fieldTokens(t))
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldTokens renders priority, due date and tags as the tokens
+// parseTokens reads back, each preceded by a space.
+func fieldTokens(t Todo) string {
+	var b strings.Builder
+	if t.Priority != PriorityNone {
+		b.WriteString(" !" + t.Priority.String())
+	}
+	if t.Due != nil {
+		b.WriteString(" due:" + formatDueToken(*t.Due))
+	}
+	for _, tag := range t.Tags {
+		b.WriteString(" #" + tag)
+	}
+	return b.String()
+}
+
+var markdownTask = regexp.MustCompile(`^(\s*)[-*+] \[([ xX])\] (.*)$`)
+
+func parseMarkdown(r io.Reader) ([]Todo, error) {
+	var items []Todo
+	// parents[i] is the ID of the last todo seen at indentation level i.
+	var parents []int
+	var levels []int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := markdownTask.FindStringSubmatch(strings.ReplaceAll(scanner.Text(), "\t", "    "))
+		if m == nil {
+			continue
+		}
+		indent := len(m[1])
+		for len(levels) > 0 && levels[len(levels)-1] >= indent {
+			levels = levels[:len(levels)-1]
+			parents = parents[:len(parents)-1]
+		}
+		t := Todo{ID: len(items) + 1, Completed: m[2] != " ", CreatedAt: time.Now()}
+		parseTokens(&t, m[3], "!", "#")
+		if t.Completed {
+			t.CompletedAt = &t.CreatedAt
+		}
+		if len(parents) > 0 {
+			t.ParentID = parents[len(parents)-1]
+		}
+		items = append(items, t)
+		levels = append(levels, indent)
+		parents = append(parents, t.ID)
+	}
+	return items, scanner.Err()
+}
+
+// parseTokens sets the title of t from text, taking out the "due:" token,
+// priority tokens (prefixed by prioPrefix) and tags (any of tagPrefixes).
+func parseTokens(t *Todo, text, prioPrefix string, tagPrefixes ...string) {
+	var words []string
+	for _, word := range strings.Fields(text) {
+		if due, ok := strings.CutPrefix(word, "due:"); ok {
+			if d, err := parseDueToken(due); err == nil {
+				t.Due = &d
+				continue
+			}
+		}
+		if prio, ok := strings.CutPrefix(word, prioPrefix); ok && prioPrefix != "" {
+			if p, err := ParsePriority(prio); err == nil && p != PriorityNone {
+				t.Priority = p
+				continue
+			}
+		}
+		isTag := false
+		for _, prefix := range tagPrefixes {
+			if tag, ok := strings.CutPrefix(word, prefix); ok && tag != "" {
+				t.Tags = append(t.Tags, normalizeTag(tag))
+				isTag = true
+				break
+			}
+		}
+		if !isTag {
+			words = append(words, word)
+		}
+	}
+	t.Title = strings.Join(words, " ")
+}
+
+// dueTokenLayout is the "due:" token of a todo due at a time of day. It
+// has no space, so the token stays one word.
+const dueTokenLayout = "2006-01-02T15:04"
+
+// formatDueToken writes the date of a due time, and the time of day too
+// unless the todo is due on the whole day.
+func formatDueToken(due time.Time) string {
+	if allDay(due) {
+		return due.Format(time.DateOnly)
+	}
+	return due.Format(dueTokenLayout)
+}
+
+func parseDueToken(s string) (time.Time, error) {
+	if d, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return d, nil
+	}
+	return time.ParseInLocation(dueTokenLayout, s, time.Local)
+}
+
+var csvHeader = []string{"id", "title", "completed", "created_at", "completed_at", "due", "priority", "tags", "parent_id"}
+
+func exportCSV(w io.Writer, todos *Todos) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, t := range todos.Items {
+		record := []string{
+			strconv.Itoa(t.ID),
+			t.Title,
+			strconv.FormatBool(t.Completed),
+			t.CreatedAt.Format(time.RFC3339),
+			formatOptionalTime(t.CompletedAt),
+			formatCSVDue(t.Due),
+			t.Priority.String(),
+			strings.Join(t.Tags, " "),
+			"",
+		}
+		if t.ParentID != 0 {
+			record[8] = strconv.Itoa(t.ParentID)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatCSVDue writes whole-day due dates without a time.
+func formatCSVDue(due *time.Time) string {
+	if due != nil && allDay(*due) {
+		return due.Format(time.DateOnly)
+	}
+	return formatOptionalTime(due)
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// parseCSV maps columns by their header names, so columns may be missing
+// or in any order. Only "title" is required.
+func parseCSV(r io.Reader) ([]Todo, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := col["title"]; !ok {
+		return nil, fmt.Errorf("csv: no title column")
+	}
+	get := func(record []string, name string) string {
+		if i, ok := col[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var items []Todo
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		t := Todo{Title: get(record, "title"), CreatedAt: time.Now()}
+		t.ID, _ = strconv.Atoi(get(record, "id"))
+		if t.ID <= 0 {
+			// Rows without an id still need a distinct one for Insert.
+			t.ID = -line
+		}
+		t.ParentID, _ = strconv.Atoi(get(record, "parent_id"))
+		if s := get(record, "completed"); s != "" {
+			if t.Completed, err = strconv.ParseBool(s); err != nil {
+				return nil, fmt.Errorf("csv line %d: invalid completed value %q", line, s)
+			}
+		}
+		if created, err := parseOptionalTime(get(record, "created_at")); err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", line, err)
+		} else if created != nil {
+			t.CreatedAt = *created
+		}
+		if t.CompletedAt, err = parseOptionalTime(get(record, "completed_at")); err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", line, err)
+		}
+		if t.Completed && t.CompletedAt == nil {
+			t.CompletedAt = &t.CreatedAt
+		}
+		if t.Due, err = parseOptionalTime(get(record, "due")); err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", line, err)
+		}
+		if t.Priority, err = ParsePriority(get(record, "priority")); err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", line, err)
+		}
+		for _, tag := range strings.FieldsFunc(get(record, "tags"), func(r rune) bool { return r == ' ' || r == ',' }) {
+			t.Tags = append(t.Tags, normalizeTag(tag))
+		}
+		items = append(items, t)
+	}
+}
+
+func parseOptionalTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid time %q", s)
+}
+
+// todo.txt priorities are letters; high, medium and low map to A, B and C.
+var todoTxtPriorities = map[Priority]string{PriorityHigh: "A", PriorityMedium: "B", PriorityLow: "C"}
+
+// exportTodoTxt writes the todo.txt format (https://github.com/todotxt/todo.txt):
+//
+//	x 2025-03-02 2025-02-20 (A) Send invoice +finance due:2025-03-01
+func exportTodoTxt(w io.Writer, todos *Todos) error {
+	for _, t := range todos.Items {
+		var parts []string
+		if t.Completed {
+			parts = append(parts, "x")
+			if t.CompletedAt != nil {
+				parts = append(parts, t.CompletedAt.Format(time.DateOnly))
+			}
+		}
+		if p, ok := todoTxtPriorities[t.Priority]; ok && !t.Completed {
+			parts = append(parts, "("+p+")")
+		}
+		parts = append(parts, t.CreatedAt.Format(time.DateOnly), t.Title)
+		for _, tag := range t.Tags {
+			parts = append(parts, "+"+tag)
+		}
+		if t.Due != nil {
+			parts = append(parts, "due:"+formatDueToken(*t.Due))
+		}
+		if t.Completed {
+			if p, ok := todoTxtPriorities[t.Priority]; ok {
+				parts = append(parts, "pri:"+p)
+			}
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(parts, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	todoTxtDate     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	todoTxtPriority = regexp.MustCompile(`^\(([A-Z])\)$`)
+)
+
+func parseTodoTxt(r io.Reader) ([]Todo, error) {
+	var items []Todo
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		t := Todo{ID: len(items) + 1, CreatedAt: time.Now()}
+		if words[0] == "x" {
+			t.Completed = true
+			words = words[1:]
+			if len(words) > 0 && todoTxtDate.MatchString(words[0]) {
+				done, _ := time.ParseInLocation(time.DateOnly, words[0], time.Local)
+				t.CompletedAt = &done
+				words = words[1:]
+			}
+		}
+		if len(words) > 0 {
+			if m := todoTxtPriority.FindStringSubmatch(words[0]); m != nil {
+				t.Priority = priorityFromLetter(m[1])
+				words = words[1:]
+			}
+		}
+		if len(words) > 0 && todoTxtDate.MatchString(words[0]) {
+			t.CreatedAt, _ = time.ParseInLocation(time.DateOnly, words[0], time.Local)
+			words = words[1:]
+		}
+		// Completed tasks lose their (A) prefix, so it's kept as pri:A.
+		var rest []string
+		for _, word := range words {
+			if p, ok := strings.CutPrefix(word, "pri:"); ok && len(p) == 1 {
+				t.Priority = priorityFromLetter(p)
+				continue
+			}
+			rest = append(rest, word)
+		}
+		parseTokens(&t, strings.Join(rest, " "), "", "+", "@")
+		if t.Completed && t.CompletedAt == nil {
+			t.CompletedAt = &t.CreatedAt
+		}
+		items = append(items, t)
+	}
+	return items, scanner.Err()
+}
+
+func priorityFromLetter(letter string) Priority {
+	for p, l := range todoTxtPriorities {
+		if l == letter {
+			return p
+		}
+	}
+	// Letters past C are still a priority, just the lowest one.
+	return PriorityLow
+}
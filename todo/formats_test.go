@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exportSample is a list using the fields every export format keeps.
+func exportSample() Todos {
+	var todos Todos
+	due := time.Date(2026, 11, 3, 0, 0, 0, 0, time.Local)
+	invoice := todos.Add("Send invoice")
+	todos.SetDue(invoice, &due)
+	todos.SetPriority(invoice, PriorityHigh)
+	todos.AddTags(invoice, "finance", "work")
+	release := todos.Add("Release 1.2")
+	deadline := time.Date(2026, 11, 5, 17, 30, 0, 0, time.Local)
+	todos.SetDue(release, &deadline)
+	notes := todos.Add("Write release notes")
+	todos.SetParent(notes, release)
+	todos.SetPriority(notes, PriorityLow)
+	todos.Toggle(notes)
+	todos.Add("Call the bank")
+	return todos
+}
+
+// describe lists the todos by their fields, without IDs or timestamps,
+// which imports don't keep.
+func describe(todos *Todos, withParents bool) []string {
+	var lines []string
+	for _, t := range todos.Items {
+		line := fmt.Sprintf("%s done=%v priority=%s tags=%v", t.Title, t.Completed, t.Priority, t.Tags)
+		if t.Due != nil {
+			line += " due=" + t.Due.Format("2006-01-02 15:04")
+		}
+		if parent, err := todos.Get(t.ParentID); err == nil && withParents {
+			line += " parent=" + parent.Title
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	tests := []struct {
+		format      string
+		keepsParent bool
+	}{
+		{"md", true},
+		{"csv", true},
+		{"todotxt", false},
+		{"json", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			todos := exportSample()
+			var buf bytes.Buffer
+			if err := todos.Export(&buf, tt.format); err != nil {
+				t.Fatal(err)
+			}
+			items, err := ParseTodos(bytes.NewReader(buf.Bytes()), tt.format)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, buf.String())
+			}
+			var imported Todos
+			added, skipped := imported.Import(items)
+			if added != len(todos.Items) || skipped != 0 {
+				t.Errorf("imported %d and skipped %d, want %d and 0", added, skipped, len(todos.Items))
+			}
+			got, want := describe(&imported, tt.keepsParent), describe(&todos, tt.keepsParent)
+			if !slices.Equal(got, want) {
+				t.Errorf("round trip through %s changed the todos\n got: %s\nwant: %s\nexport:\n%s",
+					tt.format, strings.Join(got, "\n      "), strings.Join(want, "\n      "), buf.String())
+			}
+
+			// Importing the same file again only finds duplicates.
+			added, skipped = imported.Import(items)
+			if added != 0 || skipped != len(items) {
+				t.Errorf("importing again added %d and skipped %d, want 0 and %d", added, skipped, len(items))
+			}
+		})
+	}
+}
+
+func TestParseTodosUnknownFormat(t *testing.T) {
+	if _, err := ParseTodos(strings.NewReader(""), "xml"); err == nil {
+		t.Error("ParseTodos accepted an unknown format")
+	}
+	var todos Todos
+	if err := todos.Export(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("Export accepted an unknown format")
+	}
+}
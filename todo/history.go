@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// maxHistory is how many commands can be undone.
+const maxHistory = 100
+
+// Operation is one change to one todo. Before is nil for an add and After is
+// nil for a delete; Index is where the todo sat in the list, so undoing a
+// delete puts it back in the same place. A move takes the todo from index
+// From to Index.
+type Operation struct {
+	Kind   string // add, edit, toggle, delete or move
+	ID     int
+	Index  int
+	From   int   `json:",omitempty"`
+	Before *Todo `json:",omitempty"`
+	After  *Todo `json:",omitempty"`
+}
+
+// HistoryEntry groups the operations made by one command, so `todo done 3 5`
+// is undone in one step.
+type HistoryEntry struct {
+	Command string
+	Time    time.Time
+	Ops     []Operation
+}
+
+// History is the operation log behind undo and redo. Entries before Position
+// can be undone; the ones from Position on were undone and can be redone.
+type History struct {
+	Entries  []HistoryEntry
+	Position int
+}
+
+var errHistoryConflict = errors.New("the list changed outside the history; can't apply this step")
+
+// Record adds an entry for the changes between before and after. Recording
+// drops anything that could still be redone.
+func (h *History) Record(command string, before, after Todos) {
+	ops := diffTodos(before, after)
+	if len(ops) == 0 {
+		return
+	}
+	h.Entries = append(h.Entries[:h.Position], HistoryEntry{Command: command, Time: time.Now(), Ops: ops})
+	if len(h.Entries) > maxHistory {
+		h.Entries = h.Entries[len(h.Entries)-maxHistory:]
+	}
+	h.Position = len(h.Entries)
+}
+
+// Undo reverses the most recent entry and returns it.
+func (h *History) Undo(todos *Todos) (HistoryEntry, error) {
+	if h.Position == 0 {
+		return HistoryEntry{}, errors.New("nothing to undo")
+	}
+	entry := h.Entries[h.Position-1]
+	ops := slices.Clone(entry.Ops)
+	slices.Reverse(ops)
+	for i := range ops {
+		ops[i].Before, ops[i].After = ops[i].After, ops[i].Before
+		if ops[i].Kind == "move" {
+			ops[i].Index, ops[i].From = ops[i].From, ops[i].Index
+		}
+	}
+	if err := applyOperations(todos, ops); err != nil {
+		return HistoryEntry{}, err
+	}
+	h.Position--
+	return entry, nil
+}
+
+// Redo applies the most recently undone entry again and returns it.
+func (h *History) Redo(todos *Todos) (HistoryEntry, error) {
+	if h.Position == len(h.Entries) {
+		return HistoryEntry{}, errors.New("nothing to redo")
+	}
+	entry := h.Entries[h.Position]
+	if err := applyOperations(todos, entry.Ops); err != nil {
+		return HistoryEntry{}, err
+	}
+	h.Position++
+	return entry, nil
+}
+
+// applyOperations moves each todo from its Before state to its After state.
+// It works on a copy and only replaces todos once every step succeeded.
+func applyOperations(todos *Todos, ops []Operation) error {
+	items := cloneTodos(*todos).Items
+	for _, op := range ops {
+		index := slices.IndexFunc(items, func(t Todo) bool { return t.ID == op.ID })
+		if op.Before == nil {
+			if index != -1 {
+				return errHistoryConflict
+			}
+		} else if index == -1 || !sameTodo(items[index], *op.Before) {
+			return errHistoryConflict
+		}
+
+		switch {
+		case op.Kind == "move":
+			t := items[index]
+			items = slices.Delete(items, index, index+1)
+			items = slices.Insert(items, min(max(op.Index, 0), len(items)), t)
+		case op.After == nil:
+			items = slices.Delete(items, index, index+1)
+		case op.Before == nil:
+			at := min(max(op.Index, 0), len(items))
+			items = slices.Insert(items, at, *op.After)
+		default:
+			items[index] = *op.After
+		}
+	}
+	// IDs are never reused, so NextID stays where it is even when an add
+	// is undone.
+	todos.Items = items
+	return nil
+}
+
+// diffTodos returns the operations that turn before into after.
+func diffTodos(before, after Todos) []Operation {
+	var ops []Operation
+	old := make(map[int]int, len(before.Items))
+	for i, t := range before.Items {
+		old[t.ID] = i
+	}
+	kept := make(map[int]bool, len(after.Items))
+	for _, t := range after.Items {
+		kept[t.ID] = true
+	}
+
+	// Deletes come first, from the back, so their indexes stay valid when
+	// they are replayed.
+	for i := len(before.Items) - 1; i >= 0; i-- {
+		if !kept[before.Items[i].ID] {
+			ops = append(ops, Operation{Kind: "delete", ID: before.Items[i].ID, Index: i, Before: &before.Items[i]})
+		}
+	}
+	for i := range after.Items {
+		t := after.Items[i]
+		j, existed := old[t.ID]
+		switch {
+		case !existed:
+			ops = append(ops, Operation{Kind: "add", ID: t.ID, Index: i, After: &after.Items[i]})
+		case !sameTodo(before.Items[j], t):
+			kind := "edit"
+			if toggledOnly(before.Items[j], t) {
+				kind = "toggle"
+			}
+			ops = append(ops, Operation{Kind: kind, ID: t.ID, Index: i, Before: &before.Items[j], After: &after.Items[i]})
+		}
+	}
+	return append(ops, diffOrder(before, after, ops)...)
+}
+
+// diffOrder returns the moves that put the todos in after's order once ops
+// have been applied to before.
+func diffOrder(before, after Todos, ops []Operation) []Operation {
+	if err := applyOperations(&before, ops); err != nil || len(before.Items) != len(after.Items) {
+		return nil
+	}
+	var moves []Operation
+	items := before.Items
+	for i := range after.Items {
+		if items[i].ID == after.Items[i].ID {
+			continue
+		}
+		from := slices.IndexFunc(items, func(t Todo) bool { return t.ID == after.Items[i].ID })
+		if from == -1 {
+			return nil
+		}
+		t := items[from]
+		items = slices.Insert(slices.Delete(items, from, from+1), i, t)
+		moves = append(moves, Operation{Kind: "move", ID: t.ID, Index: i, From: from, Before: &after.Items[i], After: &after.Items[i]})
+	}
+	return moves
+}
+
+func sameTodo(a, b Todo) bool {
+	ea, err1 := json.Marshal(a)
+	eb, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(ea) == string(eb)
+}
+
+// toggledOnly reports whether the only difference is the completion state.
+func toggledOnly(a, b Todo) bool {
+	a.Completed, a.CompletedAt = b.Completed, b.CompletedAt
+	return sameTodo(a, b)
+}
+
+// cloneTodos returns a deep copy, so changing the copy leaves todos alone.
+func cloneTodos(todos Todos) Todos {
+	data, _ := json.Marshal(todos)
+	var clone Todos
+	json.Unmarshal(data, &clone)
+	return clone
+}
+
+func (e HistoryEntry) String() string {
+	return fmt.Sprintf("%q from %s (%d change(s))", e.Command, e.Time.Format(time.RFC1123), len(e.Ops))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestHistoryUndoRedo(t *testing.T) {
+	base := func() Todos {
+		var todos Todos
+		todos.Add("a")
+		todos.Add("b")
+		todos.Add("c")
+		return todos
+	}
+	tests := []struct {
+		name   string
+		change func(todos *Todos)
+		kinds  []string
+	}{
+		{"add", func(todos *Todos) { todos.Add("d") }, []string{"add"}},
+		{"edit", func(todos *Todos) { todos.Edit(2, "B") }, []string{"edit"}},
+		{"toggle", func(todos *Todos) { todos.Toggle(1) }, []string{"toggle"}},
+		{"delete", func(todos *Todos) { todos.Delete(2) }, []string{"delete"}},
+		{"delete several", func(todos *Todos) { todos.Delete(1); todos.Delete(3) }, []string{"delete", "delete"}},
+		{"move", func(todos *Todos) { todos.Move(3, -1) }, []string{"move"}},
+		{"mixed", func(todos *Todos) {
+			todos.Delete(1)
+			todos.Edit(3, "C")
+			todos.Add("d")
+		}, []string{"delete", "edit", "add"}},
+		{"nothing", func(todos *Todos) {}, nil},
+	}
+	items := func(todos Todos) string {
+		data, _ := json.Marshal(todos.Items)
+		return string(data)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := base()
+			after := cloneTodos(before)
+			tt.change(&after)
+
+			ops := diffTodos(before, after)
+			var kinds []string
+			for _, op := range ops {
+				kinds = append(kinds, op.Kind)
+			}
+			if !slices.Equal(kinds, tt.kinds) {
+				t.Errorf("diffTodos gave %v, want %v", kinds, tt.kinds)
+			}
+
+			var h History
+			h.Record(tt.name, before, after)
+			if len(tt.kinds) == 0 {
+				if len(h.Entries) != 0 {
+					t.Error("recorded an entry for a command that changed nothing")
+				}
+				return
+			}
+			todos := cloneTodos(after)
+			if _, err := h.Undo(&todos); err != nil {
+				t.Fatal(err)
+			}
+			if items(todos) != items(before) {
+				t.Errorf("undo gave %s, want %s", items(todos), items(before))
+			}
+			if _, err := h.Redo(&todos); err != nil {
+				t.Fatal(err)
+			}
+			if items(todos) != items(after) {
+				t.Errorf("redo gave %s, want %s", items(todos), items(after))
+			}
+		})
+	}
+}
+
+func TestHistoryUndoConflict(t *testing.T) {
+	var before Todos
+	before.Add("a")
+	after := cloneTodos(before)
+	after.Edit(1, "b")
+	var h History
+	h.Record("edit", before, after)
+
+	// The list changed behind the history's back.
+	todos := cloneTodos(after)
+	todos.Edit(1, "c")
+	if _, err := h.Undo(&todos); !errors.Is(err, errHistoryConflict) {
+		t.Errorf("undo over an outside change: got %v, want errHistoryConflict", err)
+	}
+	if title := todos.Items[0].Title; title != "c" {
+		t.Errorf("a failed undo changed the list: title is %q", title)
+	}
+}
+
+func TestHistoryRecordDropsRedo(t *testing.T) {
+	var v1 Todos
+	v1.Add("a")
+	v2 := cloneTodos(v1)
+	v2.Add("b")
+	var h History
+	h.Record("add", v1, v2)
+	todos := cloneTodos(v2)
+	h.Undo(&todos)
+
+	v3 := cloneTodos(todos)
+	v3.Edit(1, "A")
+	h.Record("edit", todos, v3)
+	if _, err := h.Redo(&v3); err == nil {
+		t.Error("redo succeeded after a new command was recorded")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Named lists live as one store per list in the data directory; the name of
+// the list commands use by default is kept in the "current" file there.
+
+const defaultList = "default"
+
+var listNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// dataDir returns the directory holding the named lists: $TODO_DIR,
+// $XDG_DATA_HOME/todo or ~/.local/share/todo, in that order.
+func dataDir() (string, error) {
+	if dir := os.Getenv("TODO_DIR"); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "todo"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("finding the data directory: %w (set TODO_DIR or XDG_DATA_HOME)", err)
+	}
+	return filepath.Join(home, ".local", "share", "todo"), nil
+}
+
+func validateListName(name string) error {
+	if !listNamePattern.MatchString(name) || strings.HasSuffix(name, ".history") || strings.HasSuffix(name, ".lock") || strings.HasSuffix(name, ".reminders") || strings.HasSuffix(name, ".archive") {
+		return fmt.Errorf("invalid list name %q (use letters, digits, '.', '_' and '-')", name)
+	}
+	return nil
+}
+
+// currentList returns the name of the list selected with `todo switch`.
+func currentList(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "current"))
+	if err != nil {
+		return defaultList
+	}
+	if name := strings.TrimSpace(string(data)); validateListName(name) == nil {
+		return name
+	}
+	return defaultList
+}
+
+func setCurrentList(dir, name string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, "current"), []byte(name+"\n"), 0644)
+}
+
+func listFile(dir, name, backend string) string {
+	return filepath.Join(dir, name+backendExt(backend))
+}
+
+// listNames returns the lists in dir that use the given backend, sorted.
+func listNames(dir, backend string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), backendExt(backend))
+		if ok && !e.IsDir() && validateListName(name) == nil {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// resolveStore fills in options.File from the selected list when no file
+// was given explicitly, creating the data directory if needed.
+func (o *globalOptions) resolveStore() error {
+	backend, err := normalizeBackend(o.Store)
+	if err != nil {
+		return err
+	}
+	o.Store = backend
+	if o.File != "" || o.Remote != "" {
+		return nil
+	}
+	dir, err := dataDir()
+	if err != nil {
+		return err
+	}
+	if o.List == "" {
+		o.List = currentList(dir)
+	}
+	if err := validateListName(o.List); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	o.Dir = dir
+	o.File = listFile(dir, o.List, backend)
+	return nil
+}
+
+// requireLists fails when -file bypasses named lists.
+func (o *globalOptions) requireLists() error {
+	if o.Dir == "" {
+		return errors.New("named lists aren't available with -file or -remote")
+	}
+	return nil
+}
+
+// withList loads another named list, lets fn change it and saves it again
+// under that list's lock.
+func withList(name string, fn func(todos *Todos) error) error {
+	file := listFile(options.Dir, name, options.Store)
+	store, err := openStore(options.Store, file)
+	if err != nil {
+		return err
+	}
+	unlock, err := store.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	todos := Todos{}
+	if err := store.Load(&todos); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("loading list %s: %w", name, err)
+	}
+	if err := fn(&todos); err != nil {
+		return err
+	}
+	if err := store.Save(todos); err != nil {
+		return fmt.Errorf("saving list %s: %w", name, err)
+	}
+	return nil
+}
+
+// Take removes the given todos, with their subtasks, and returns them in
+// list order.
+func (todos *Todos) Take(ids []int) ([]Todo, error) {
+	taking := make(map[int]bool)
+	for _, id := range ids {
+		if _, err := todos.Get(id); err != nil {
+			return nil, err
+		}
+		taking[id] = true
+		for _, child := range todos.descendants(id) {
+			taking[child] = true
+		}
+	}
+	var taken []Todo
+	var parents []int
+	kept := todos.Items[:0:0]
+	for _, t := range todos.Items {
+		if taking[t.ID] {
+			taken = append(taken, t)
+			if t.ParentID != 0 && !taking[t.ParentID] {
+				parents = append(parents, t.ParentID)
+			}
+		} else {
+			kept = append(kept, t)
+		}
+	}
+	todos.Items = kept
+	todos.dropDependencies()
+	for _, parent := range parents {
+		if err := todos.syncParent(parent); err != nil {
+			return nil, err
+		}
+	}
+	return taken, nil
+}
+
+// Insert appends todos taken from another list. They get new IDs here;
+// subtask links and dependencies between them are kept and links to todos
+// that didn't come along are dropped. It returns the new ID of each todo by
+// its old ID.
+func (todos *Todos) Insert(items []Todo) map[int]int {
+	newIDs := make(map[int]int, len(items))
+	for _, t := range items {
+		newIDs[t.ID] = todos.Add(t.Title)
+	}
+	for _, t := range items {
+		t.ID = newIDs[t.ID]
+		t.ParentID = newIDs[t.ParentID]
+		t.NextOccurrence = newIDs[t.NextOccurrence]
+		var deps []int
+		for _, dep := range t.DependsOn {
+			if newID, ok := newIDs[dep]; ok {
+				deps = append(deps, newID)
+			}
+		}
+		t.DependsOn = deps
+		index, _ := todos.indexOf(t.ID)
+		t.UID = todos.Items[index].UID
+		todos.Items[index] = t
+	}
+	return newIDs
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestValidateListName(t *testing.T) {
+	valid := []string{"default", "work", "Home-2", "side_project", "v1.2"}
+	invalid := []string{"", ".hidden", "-flag", "a/b", "../up", "two words", "work.history", "work.lock", "work.reminders", "work.archive", "émoji"}
+	for _, name := range valid {
+		if err := validateListName(name); err != nil {
+			t.Errorf("validateListName(%q): %v", name, err)
+		}
+	}
+	for _, name := range invalid {
+		if err := validateListName(name); err == nil {
+			t.Errorf("validateListName(%q) accepted a bad name", name)
+		}
+	}
+}
+
+func TestResolveStore(t *testing.T) {
+	dir := useTestDir(t)
+	tests := []struct {
+		name    string
+		opts    globalOptions
+		current string // contents of the "current" file
+		file    string
+		wantErr bool
+	}{
+		{"default list", globalOptions{}, "", filepath.Join(dir, "default.json"), false},
+		{"current list", globalOptions{}, "work\n", filepath.Join(dir, "work.json"), false},
+		{"bad current list", globalOptions{}, "../up\n", filepath.Join(dir, "default.json"), false},
+		{"named list", globalOptions{List: "home"}, "work\n", filepath.Join(dir, "home.json"), false},
+		{"backend", globalOptions{List: "home", Store: "SQLite"}, "", filepath.Join(dir, "home.db"), false},
+		{"explicit file", globalOptions{File: "todos.json", List: "home"}, "", "todos.json", false},
+		{"bad list name", globalOptions{List: "../up"}, "", "", true},
+		{"bad backend", globalOptions{Store: "csv"}, "", "", true},
+	}
+	for _, tt := range tests {
+		os.Remove(filepath.Join(dir, "current"))
+		if tt.current != "" {
+			os.WriteFile(filepath.Join(dir, "current"), []byte(tt.current), 0644)
+		}
+		o := tt.opts
+		err := o.resolveStore()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: no error", tt.name)
+			}
+			continue
+		}
+		if err != nil || o.File != tt.file {
+			t.Errorf("%s: file %q (%v), want %q", tt.name, o.File, err, tt.file)
+		}
+		if (o.Dir != "") != (tt.opts.File == "") {
+			t.Errorf("%s: data directory %q", tt.name, o.Dir)
+		}
+	}
+}
+
+// moveSample is a list with a subtask tree, dependencies across it and a
+// todo that stays behind.
+func moveSample() Todos {
+	var todos Todos
+	todos.Add("Stay")               // 1
+	release := todos.Add("Release") // 2
+	notes := todos.Add("Notes")     // 3
+	todos.SetParent(notes, release)
+	draft := todos.Add("Draft") // 4
+	todos.SetParent(draft, notes)
+	todos.AddDependency(notes, draft)
+	todos.AddDependency(release, 1)
+	return todos
+}
+
+func TestTakeBringsSubtasks(t *testing.T) {
+	todos := moveSample()
+	taken, err := todos.Take([]int{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, item := range taken {
+		ids = append(ids, item.ID)
+	}
+	if !slices.Equal(ids, []int{2, 3, 4}) {
+		t.Errorf("took %v, want the todo and its subtasks [2 3 4]", ids)
+	}
+	if len(todos.Items) != 1 || todos.Items[0].ID != 1 {
+		t.Errorf("left %+v, want only todo 1", todos.Items)
+	}
+
+	// Taking a subtask alone leaves its parent behind.
+	todos = moveSample()
+	if taken, _ = todos.Take([]int{4}); len(taken) != 1 || len(todos.Items) != 3 {
+		t.Errorf("took %d and left %d todos, want 1 and 3", len(taken), len(todos.Items))
+	}
+	if _, err := todos.Take([]int{9}); err == nil {
+		t.Error("took a todo that doesn't exist")
+	}
+}
+
+func TestInsertRenumbers(t *testing.T) {
+	from := moveSample()
+	taken, err := from.Take([]int{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	taken[0].NextOccurrence = 1 // a repeat that stayed in the other list
+	var to Todos
+	to.Add("Already here")
+	to.Add("Also here")
+	newIDs := to.Insert(taken)
+
+	want := map[int]int{2: 3, 3: 4, 4: 5}
+	for old, id := range want {
+		if newIDs[old] != id {
+			t.Errorf("todo %d became %d, want %d", old, newIDs[old], id)
+		}
+	}
+	release, _ := to.Get(3)
+	notes, _ := to.Get(4)
+	draft, _ := to.Get(5)
+	if release.Title != "Release" || notes.Title != "Notes" || draft.Title != "Draft" {
+		t.Fatalf("inserted %+v", to.Items[2:])
+	}
+	if notes.ParentID != 3 || draft.ParentID != 4 || release.ParentID != 0 {
+		t.Errorf("parents %d, %d and %d, want 0, 3 and 4", release.ParentID, notes.ParentID, draft.ParentID)
+	}
+	if !slices.Equal(notes.DependsOn, []int{5}) {
+		t.Errorf("notes depends on %v, want [5]", notes.DependsOn)
+	}
+	if len(release.DependsOn) != 0 {
+		t.Errorf("release depends on %v, a todo that stayed in the other list", release.DependsOn)
+	}
+	if release.NextOccurrence != 0 {
+		t.Errorf("release's next occurrence is %d, a todo that stayed in the other list", release.NextOccurrence)
+	}
+	if to.NextID != 6 {
+		t.Errorf("NextID %d, want 6", to.NextID)
+	}
+	uids := make(map[string]bool)
+	for _, item := range to.Items {
+		if item.UID == "" || uids[item.UID] {
+			t.Errorf("todo %d has a missing or repeated UID %q", item.ID, item.UID)
+		}
+		uids[item.UID] = true
+	}
+}
+
+func TestMoveBetweenLists(t *testing.T) {
+	dir := useTestDir(t)
+	runTodo(t, "add", "Stay")
+	runTodo(t, "add", "Go")
+	if code, out := runTodo(t, "mv", "2", "work"); code != 0 {
+		t.Fatalf("mv: exit code %d\n%s", code, out)
+	}
+	source, _ := loadList(defaultList)
+	target, _ := loadList("work")
+	if len(source.Items) != 1 || len(target.Items) != 1 || target.Items[0].Title != "Go" {
+		t.Fatalf("after mv the lists hold %+v and %+v", source.Items, target.Items)
+	}
+
+	// A target list that can't be saved leaves the todo where it was.
+	newer := []byte(`{"version":99,"data":{"NextID":1,"Items":[]}}`)
+	os.WriteFile(filepath.Join(dir, "newer.json"), newer, 0644)
+	if code, _ := runTodo(t, "mv", "1", "newer"); code != 1 {
+		t.Errorf("mv to a list that can't be saved: exit code %d, want 1", code)
+	}
+	source, _ = loadList(defaultList)
+	if len(source.Items) != 1 || source.Items[0].Title != "Stay" {
+		t.Errorf("after a failed mv the list holds %+v", source.Items)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "newer.json")); string(data) != string(newer) {
+		t.Error("a failed mv changed the target list")
+	}
+}
@@ -0,0 +1,37 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockHeld(t *testing.T) {
+	store := NewStorage[Todos](filepath.Join(t.TempDir(), "todos.json"))
+	unlock, err := store.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := store.Lock(); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Lock: got %v, want ErrLocked", err)
+	}
+	if waited := time.Since(start); waited < lockTimeout {
+		t.Errorf("gave up after %v, want to keep trying for %v", waited, lockTimeout)
+	}
+
+	// A lock released while Lock waits is taken.
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		unlock()
+	}()
+	unlock2, err := store.Lock()
+	if err != nil {
+		t.Fatalf("Lock after the holder let go: %v", err)
+	}
+	unlock2()
+}
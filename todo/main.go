@@ -1,23 +1,232 @@
 package main
 
-// import (
-// 	"fmt"
-// )
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// globalOptions are the flags that come before the command name. Each can
+// also be set through an environment variable.
+type globalOptions struct {
+	Store string // backend name, TODO_STORE
+	File  string // data file, TODO_FILE; overrides named lists
+	List  string // named list, TODO_LIST; defaults to the current list
+	// Remote is the URL of a `todo serve` instance to use instead of a
+	// local store, TODO_REMOTE.
+	Remote string
+	// KeyFile unlocks encrypted lists, TODO_KEY_FILE; TODO_PASSPHRASE
+	// gives a passphrase instead.
+	KeyFile string
+
+	Dir string // data directory holding the named lists, unless File was given
+}
+
+var options globalOptions
+
+// currentStore is the store of the list a command runs on. main saves it
+// once the command is done; mv saves it earlier, before changing another
+// list.
+var currentStore Store[Todos]
+
+// history is the undo/redo log of the current store. main loads it before a
+// mutating command runs and records the command's changes afterwards.
+var history = &History{}
 
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// parseGlobalFlags reads the options in front of the command and returns
+// the command line that follows them.
+func parseGlobalFlags(args []string) ([]string, error) {
+	fs := flag.NewFlagSet("todo", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() { printUsage(fs.Output()) }
+	fs.StringVar(&options.Store, "store", os.Getenv("TODO_STORE"), "storage backend: "+strings.Join(backends, ", ")+" (env TODO_STORE)")
+	fs.StringVar(&options.File, "file", os.Getenv("TODO_FILE"), "use this data file instead of a named list (env TODO_FILE)")
+	fs.StringVar(&options.List, "list", os.Getenv("TODO_LIST"), "named list to use instead of the current one (env TODO_LIST)")
+	fs.StringVar(&options.Remote, "remote", os.Getenv("TODO_REMOTE"), "URL of a `todo serve` server to use instead of a local list (env TODO_REMOTE)")
+	fs.StringVar(&options.KeyFile, "key-file", os.Getenv("TODO_KEY_FILE"), "key file for encrypted lists (env TODO_KEY_FILE; or set TODO_PASSPHRASE)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	secret = &Secret{Passphrase: os.Getenv("TODO_PASSPHRASE"), KeyFile: options.KeyFile, Prompt: true}
+	return fs.Args(), nil
+}
+
+// run executes a single command and returns the process exit code: 0 on
+// success, 1 when the command fails and 2 for usage errors.
+func run(args []string) int {
+	args, err := parseGlobalFlags(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return 2
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "todo: unknown command %q\n\n", args[0])
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	if err := options.resolveStore(); err != nil {
+		fmt.Fprintf(os.Stderr, "todo: %v\n", err)
+		return 2
+	}
+	todos := Todos{}
+	if cmd.NoStore {
+		return exitCode(cmd, cmd.Run(cmd, &todos, args[1:]))
+	}
+
+	storage, historyStorage, err := openCurrentStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "todo: %v\n", err)
+		return 2
+	}
+	currentStore = storage
+	// Hold the lock from load to save so a concurrent todo process can't
+	// overwrite our changes or have its own overwritten.
+	unlock, err := storage.Lock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "todo: %v\n", err)
+		return 1
+	}
+	defer unlock()
+
+	if err := storage.Load(&todos); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "todo: loading todos: %v\n", err)
+		return 1
+	}
+
+	// Stop before the command runs, rather than after it reports changes
+	// that can't be saved, when a newer version of todo wrote the list.
+	if w, ok := storage.(interface{ CheckWritable() error }); ok && cmd.Mutates {
+		if err := w.CheckWritable(); err != nil {
+			fmt.Fprintf(os.Stderr, "todo: %v\n", err)
+			return 1
+		}
+	}
+
+	keepHistory := cmd.Mutates && historyStorage != nil
+	if keepHistory {
+		if err := historyStorage.Load(history); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "todo: loading history: %v\n", err)
+			return 1
+		}
+	}
+	before := cloneTodos(todos)
+
+	if code := exitCode(cmd, cmd.Run(cmd, &todos, args[1:])); code != 0 {
+		return code
+	}
+
+	if cmd.Mutates {
+		if !cmd.NoAutoArchive && !cmd.NoHistory {
+			if err := autoArchive(&todos); err != nil {
+				fmt.Fprintf(os.Stderr, "todo: archiving todos: %v\n", err)
+				return 1
+			}
+		}
+		if keepHistory && !cmd.NoHistory {
+			history.Record(cmd.Name, before, todos)
+		}
+		if err := storage.Save(todos); err != nil {
+			fmt.Fprintf(os.Stderr, "todo: saving todos: %v\n", err)
+			return 1
+		}
+		if keepHistory {
+			if err := historyStorage.Save(*history); err != nil {
+				fmt.Fprintf(os.Stderr, "todo: saving history: %v\n", err)
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// exitCode reports a command's error and turns it into an exit code.
+func exitCode(cmd *Command, err error) int {
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "todo %s: %v\n", cmd.Name, err)
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		return 2
+	}
+	return 1
+}
+
+// openCurrentStore opens the list the global options select and its history.
+// The history is nil for a remote list, whose server keeps the history.
+func openCurrentStore() (Store[Todos], *Storage[History], error) {
+	if options.Remote != "" {
+		return NewRemoteStore(options.Remote), nil, nil
+	}
+	store, err := openStore(options.Store, options.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, openHistory(options.File), nil
+}
+
+// viewList loads the list under the store's lock. It and updateList are for
+// long-running modes (serve, tui) that mustn't keep the list locked between
+// changes.
+func viewList(store Store[Todos]) (Todos, error) {
+	unlock, err := store.Lock()
+	if err != nil {
+		return Todos{}, err
+	}
+	defer unlock()
+	todos := Todos{}
+	if err := store.Load(&todos); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Todos{}, err
+	}
+	return todos, nil
+}
+
+// updateList loads the list, applies fn and saves the result, recording the
+// change for undo under the given command name when history isn't nil.
+func updateList(store Store[Todos], history *Storage[History], command string, fn func(todos *Todos) error) (Todos, error) {
+	unlock, err := store.Lock()
+	if err != nil {
+		return Todos{}, err
+	}
+	defer unlock()
+
 	todos := Todos{}
-	storage := NewStorage[Todos]("todos.json")
-	storage.Load(&todos)
-	cmdFlags := NewCmdFlags()
-	cmdFlags.Execute(&todos)
-	// todos.Add("Buy milk")
-	// todos.Add("buy car")
-	// fmt.Printf("%+v\n\n", todos)
-	// todos.Print()
-	// todos.Delete(0)
-	// fmt.Printf("%+v\n\n", todos)
-	// todos.Toggle(0)
-	// todos.Print()
-
-	storage.Save(todos)
-}
\ No newline at end of file
+	if err := store.Load(&todos); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Todos{}, err
+	}
+	h := History{}
+	if history != nil {
+		if err := history.Load(&h); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Todos{}, err
+		}
+	}
+	before := cloneTodos(todos)
+	if err := fn(&todos); err != nil {
+		return Todos{}, err
+	}
+	if err := autoArchive(&todos); err != nil {
+		return Todos{}, err
+	}
+	if err := store.Save(todos); err != nil {
+		return Todos{}, err
+	}
+	if history == nil {
+		return todos, nil
+	}
+	h.Record(command, before, todos)
+	return todos, history.Save(h)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats for listings and for the todos a command changed. "table"
+// is the default human-readable table (or message, for mutating commands).
+var outputFormats = []string{"table", "json", "yaml", "csv", "plain"}
+
+// TodoView is the stable shape of a todo in machine-readable output and the
+// data passed to -template.
+type TodoView struct {
+	ID          int        `json:"id" yaml:"id"`
+	Title       string     `json:"title" yaml:"title"`
+	Completed   bool       `json:"completed" yaml:"completed"`
+	CreatedAt   time.Time  `json:"created_at" yaml:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" yaml:"completed_at,omitempty"`
+	Due         *time.Time `json:"due,omitempty" yaml:"due,omitempty"`
+	Overdue     bool       `json:"overdue" yaml:"overdue"`
+	Priority    string     `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Tags        []string   `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Repeat      string     `json:"repeat,omitempty" yaml:"repeat,omitempty"`
+	ParentID    int        `json:"parent_id,omitempty" yaml:"parent_id,omitempty"`
+	DependsOn   []int      `json:"depends_on,omitempty" yaml:"depends_on,omitempty"`
+	// Tracked is the time worked on the todo in seconds; TimerStarted is
+	// set while its timer runs.
+	Tracked      int64      `json:"tracked,omitempty" yaml:"tracked,omitempty"`
+	TimerStarted *time.Time `json:"timer_started,omitempty" yaml:"timer_started,omitempty"`
+}
+
+func newTodoView(t Todo, now time.Time) TodoView {
+	v := TodoView{
+		ID:          t.ID,
+		Title:       t.Title,
+		Completed:   t.Completed,
+		CreatedAt:   t.CreatedAt,
+		CompletedAt: t.CompletedAt,
+		Due:         t.Due,
+		Overdue:     t.IsOverdue(now),
+		Priority:    t.Priority.String(),
+		Tags:        t.Tags,
+		ParentID:    t.ParentID,
+		DependsOn:   t.DependsOn,
+	}
+	if t.Repeat != nil {
+		v.Repeat = t.Repeat.String()
+	}
+	v.Tracked = int64(t.Tracked(now) / time.Second)
+	if s := t.Timer(); s != nil {
+		v.TimerStarted = &s.Start
+	}
+	return v
+}
+
+// outputOptions are the -output and -template flags shared by ls and the
+// commands that change todos.
+type outputOptions struct {
+	format   string
+	template string
+}
+
+func (o *outputOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.format, "output", "table", "output format: "+strings.Join(outputFormats, ", "))
+	fs.StringVar(&o.template, "template", "", "print each todo with this Go text/template, e.g. '{{.ID}} {{.Title}}'")
+}
+
+// check validates the flags before a command changes anything.
+func (o *outputOptions) check() error {
+	o.format = strings.ToLower(o.format)
+	if !slices.Contains(outputFormats, o.format) {
+		return usagef("unknown output format %q (use %s)", o.format, strings.Join(outputFormats, ", "))
+	}
+	if o.template != "" {
+		if o.format != "table" {
+			return usagef("-template can't be combined with -output %s", o.format)
+		}
+		if _, err := o.parseTemplate(); err != nil {
+			return usagef("%v", err)
+		}
+	}
+	return nil
+}
+
+// custom reports whether the user asked for something other than the
+// default table or message.
+func (o *outputOptions) custom() bool {
+	return o.format != "table" || o.template != ""
+}
+
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// date formats an optional time with a Go layout, or "" when it's nil.
+	"date": func(layout string, t any) string {
+		switch t := t.(type) {
+		case time.Time:
+			return t.Format(layout)
+		case *time.Time:
+			if t != nil {
+				return t.Format(layout)
+			}
+		}
+		return ""
+	},
+}
+
+func (o *outputOptions) parseTemplate() (*template.Template, error) {
+	return template.New("todo").Funcs(templateFuncs).Parse(o.template)
+}
+
+// write prints todos in the chosen format. Table output goes through
+// Todos.Print, so it only makes sense for listings.
+func (o *outputOptions) write(w io.Writer, todos *Todos) error {
+	now := time.Now()
+	views := make([]TodoView, len(todos.Items))
+	for i, t := range todos.Items {
+		views[i] = newTodoView(t, now)
+	}
+
+	if o.template != "" {
+		tmpl, err := o.parseTemplate()
+		if err != nil {
+			return err
+		}
+		for _, v := range views {
+			if err := tmpl.Execute(w, v); err != nil {
+				return err
+			}
+			fmt.Fprintln(w)
+		}
+		return nil
+	}
+
+	switch o.format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(views)
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(views); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "csv":
+		return exportCSV(w, todos)
+	case "plain":
+		for _, t := range todos.Items {
+			fmt.Fprintln(w, plainLine(t))
+		}
+		return nil
+	}
+	todos.Print()
+	return nil
+}
+
+// plainLine renders a todo on one line without colours or emoji:
+// "3 [ ] Buy milk !high due:2025-03-01 #errands".
+func plainLine(t Todo) string {
+	box := " "
+	if t.Completed {
+		box = "x"
+	}
+	return strconv.Itoa(t.ID) + " [" + box + "] " + t.Title + fieldTokens(t)
+}
+
+// echo prints the todos a command changed when -output or -template was
+// given, and returns false when the command should print its usual message.
+func (o *outputOptions) echo(items []Todo) (bool, error) {
+	if !o.custom() {
+		return false, nil
+	}
+	return true, o.write(os.Stdout, &Todos{Items: items})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// outputSample has a title CSV has to quote, a timed due date long past and
+// a finished work session, so the output doesn't depend on when it runs.
+func outputSample() Todos {
+	at := func(day, hour, minute int) *time.Time {
+		t := time.Date(2020, 3, day, hour, minute, 0, 0, time.UTC)
+		return &t
+	}
+	return Todos{NextID: 3, Items: []Todo{
+		{
+			ID: 1, Title: `Buy "milk", eggs`, CreatedAt: *at(1, 9, 0),
+			Due: at(2, 0, 0), Priority: PriorityHigh, Tags: []string{"errands", "home"},
+			Sessions: []WorkSession{{Start: *at(1, 10, 0), End: at(1, 10, 30)}},
+		},
+		{
+			ID: 2, Title: "Call Bob", Completed: true, CreatedAt: *at(1, 9, 5),
+			CompletedAt: at(1, 17, 0), Due: at(3, 14, 30), ParentID: 1,
+		},
+	}}
+}
+
+func TestOutputFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"json", `[
+  {
+    "id": 1,
+    "title": "Buy \"milk\", eggs",
+    "completed": false,
+    "created_at": "2020-03-01T09:00:00Z",
+    "due": "2020-03-02T00:00:00Z",
+    "overdue": true,
+    "priority": "high",
+    "tags": [
+      "errands",
+      "home"
+    ],
+    "tracked": 1800
+  },
+  {
+    "id": 2,
+    "title": "Call Bob",
+    "completed": true,
+    "created_at": "2020-03-01T09:05:00Z",
+    "completed_at": "2020-03-01T17:00:00Z",
+    "due": "2020-03-03T14:30:00Z",
+    "overdue": false,
+    "parent_id": 1
+  }
+]
+`},
+		{"yaml", `- id: 1
+  title: Buy "milk", eggs
+  completed: false
+  created_at: 2020-03-01T09:00:00Z
+  due: 2020-03-02T00:00:00Z
+  overdue: true
+  priority: high
+  tags:
+    - errands
+    - home
+  tracked: 1800
+- id: 2
+  title: Call Bob
+  completed: true
+  created_at: 2020-03-01T09:05:00Z
+  completed_at: 2020-03-01T17:00:00Z
+  due: 2020-03-03T14:30:00Z
+  overdue: false
+  parent_id: 1
+`},
+		{"csv", `id,title,completed,created_at,completed_at,due,priority,tags,parent_id
+1,"Buy ""milk"", eggs",false,2020-03-01T09:00:00Z,,2020-03-02,high,errands home,
+2,Call Bob,true,2020-03-01T09:05:00Z,2020-03-01T17:00:00Z,2020-03-03T14:30:00Z,,,1
+`},
+		{"plain", `1 [ ] Buy "milk", eggs !high due:2020-03-02 #errands #home
+2 [x] Call Bob due:2020-03-03T14:30
+`},
+	}
+	for _, tt := range tests {
+		todos := outputSample()
+		o := outputOptions{format: tt.format}
+		if err := o.check(); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		var buf bytes.Buffer
+		if err := o.write(&buf, &todos); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s output\n%s\nwant\n%s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestOutputTemplate(t *testing.T) {
+	todos := outputSample()
+	o := outputOptions{format: "table", template: `{{.ID}} {{upper .Title}} [{{join .Tags ","}}] {{date "2006-01-02" .Due}} {{date "15:04" .CompletedAt}}`}
+	if err := o.check(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := o.write(&buf, &todos); err != nil {
+		t.Fatal(err)
+	}
+	want := "1 BUY \"MILK\", EGGS [errands,home] 2020-03-02 \n2 CALL BOB [] 2020-03-03 17:00\n"
+	if got := buf.String(); got != want {
+		t.Errorf("template output %q, want %q", got, want)
+	}
+}
+
+func TestOutputOptionsCheck(t *testing.T) {
+	tests := []struct {
+		o       outputOptions
+		wantErr string // "" when the options are fine
+	}{
+		{outputOptions{format: "table"}, ""},
+		{outputOptions{format: "JSON"}, ""},
+		{outputOptions{format: "table", template: "{{.Title}}"}, ""},
+		{outputOptions{format: "xml"}, `unknown output format "xml"`},
+		{outputOptions{format: "json", template: "{{.Title}}"}, "can't be combined with -output json"},
+		{outputOptions{format: "table", template: "{{.Title"}, "unclosed action"},
+		{outputOptions{format: "table", template: "{{nope .Title}}"}, `function "nope" not defined`},
+	}
+	for _, tt := range tests {
+		err := tt.o.check()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%+v: %v", tt.o, err)
+			}
+			continue
+		}
+		var usage *usageError
+		if !errors.As(err, &usage) || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%+v: got error %v, want a usage error mentioning %q", tt.o, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Priority ranks how urgent a todo is. The zero value means no priority was
+// set, and higher values are more urgent.
+type Priority int
+
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
+var priorityNames = map[Priority]string{
+	PriorityNone:   "",
+	PriorityLow:    "low",
+	PriorityMedium: "medium",
+	PriorityHigh:   "high",
+}
+
+func (p Priority) String() string {
+	return priorityNames[p]
+}
+
+// ParsePriority accepts a priority name, its first letter or its number
+// (0-3). "none" clears the priority.
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none", "0":
+		return PriorityNone, nil
+	case "low", "l", "1":
+		return PriorityLow, nil
+	case "medium", "med", "m", "2":
+		return PriorityMedium, nil
+	case "high", "h", "3":
+		return PriorityHigh, nil
+	}
+	return PriorityNone, fmt.Errorf("invalid priority %q (use low, medium, high or none)", s)
+}
+
+// Priorities are stored by name so todos.json stays readable.
+func (p Priority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Priority) UnmarshalText(text []byte) error {
+	parsed, err := ParsePriority(string(text))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Query selects and orders todos for listing. Zero values mean "no filter",
+// so an empty Query returns every todo in insertion order.
+type Query struct {
+	Pending    bool
+	Done       bool
+	Actionable bool       // todo must be open and not wait on open todos
+	Tags       []string   // todo must carry every tag
+	Priorities []Priority // todo must have one of these priorities
+	DueBefore  *time.Time // todo must be due before this time
+	Search     string     // every word must appear in the title
+	SortBy     string
+	Reverse    bool
+}
+
+// The "list" order is the order todos were added in, as rearranged by
+// reordering them in the TUI, which shows the list in that order.
+var sortKeys = []string{"created", "list", "due", "priority", "completed"}
+
+// Match reports whether a todo passes every filter in the query.
+func (q Query) Match(t Todo) bool {
+	if q.Pending && t.Completed {
+		return false
+	}
+	if q.Done && !t.Completed {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !t.HasTag(tag) {
+			return false
+		}
+	}
+	if len(q.Priorities) > 0 && !slices.Contains(q.Priorities, t.Priority) {
+		return false
+	}
+	if q.DueBefore != nil && (t.Due == nil || !t.Due.Before(*q.DueBefore)) {
+		return false
+	}
+	title := strings.ToLower(t.Title)
+	for _, word := range strings.Fields(strings.ToLower(q.Search)) {
+		if !strings.Contains(title, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// Query returns a new list holding the matching todos in the requested
+// order. The items are copies, so changing them leaves the original alone.
+func (todos *Todos) Query(q Query) (Todos, error) {
+	result := Todos{NextID: todos.NextID, source: todos}
+	position := make(map[int]int, len(todos.Items))
+	for i, t := range todos.Items {
+		position[t.ID] = i
+		if q.Match(t) && (!q.Actionable || todos.Actionable(t.ID)) {
+			result.Items = append(result.Items, t)
+		}
+	}
+
+	var compare func(a, b Todo) int
+	switch q.SortBy {
+	case "", "created":
+		compare = func(a, b Todo) int { return a.CreatedAt.Compare(b.CreatedAt) }
+	case "list":
+		compare = func(a, b Todo) int { return cmp.Compare(position[a.ID], position[b.ID]) }
+	case "due":
+		compare = func(a, b Todo) int { return compareTimes(a.Due, b.Due) }
+	case "priority":
+		// Most urgent first.
+		compare = func(a, b Todo) int { return cmp.Compare(b.Priority, a.Priority) }
+	case "completed":
+		compare = func(a, b Todo) int { return compareTimes(a.CompletedAt, b.CompletedAt) }
+	default:
+		return Todos{}, fmt.Errorf("invalid sort key %q (use %s)", q.SortBy, strings.Join(sortKeys, ", "))
+	}
+	if q.Reverse {
+		forward := compare
+		compare = func(a, b Todo) int { return forward(b, a) }
+	}
+	slices.SortStableFunc(result.Items, compare)
+	return result, nil
+}
+
+// compareTimes orders optional times earliest first, with missing times last.
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	return a.Compare(*b)
+}
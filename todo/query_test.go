@@ -0,0 +1,106 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// querySample is a list whose order differs from the order its todos were
+// created in, as after reordering in the TUI.
+func querySample() Todos {
+	day := func(d int) *time.Time {
+		t := time.Date(2026, 10, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	created := func(d int) time.Time { return *day(d) }
+	todos := Todos{NextID: 6, Items: []Todo{
+		{ID: 3, Title: "Call the bank", CreatedAt: created(3), Priority: PriorityHigh, Tags: []string{"finance"}, Due: day(20)},
+		{ID: 1, Title: "Send invoice", CreatedAt: created(1), Priority: PriorityHigh, Tags: []string{"finance", "work"}, Due: day(16), Completed: true, CompletedAt: day(15)},
+		{ID: 4, Title: "Write release notes", CreatedAt: created(4), Priority: PriorityLow, Tags: []string{"work"}, DependsOn: []int{5}},
+		{ID: 2, Title: "Book train", CreatedAt: created(2), Due: day(18), Completed: true, CompletedAt: day(11)},
+		{ID: 5, Title: "Release 1.2", CreatedAt: created(5), Priority: PriorityMedium, Tags: []string{"work"}, Due: day(17)},
+	}}
+	return todos
+}
+
+func TestQueryFilters(t *testing.T) {
+	dueBefore := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		q    Query
+		want []int
+	}{
+		{"everything", Query{}, []int{1, 2, 3, 4, 5}},
+		{"pending", Query{Pending: true}, []int{3, 4, 5}},
+		{"done", Query{Done: true}, []int{1, 2}},
+		{"actionable", Query{Actionable: true}, []int{3, 5}},
+		{"tag", Query{Tags: []string{"work"}}, []int{1, 4, 5}},
+		{"every tag", Query{Tags: []string{"#Work", "finance"}}, []int{1}},
+		{"priority", Query{Priorities: []Priority{PriorityHigh}}, []int{1, 3}},
+		{"any priority", Query{Priorities: []Priority{PriorityLow, PriorityNone}}, []int{2, 4}},
+		{"due before", Query{DueBefore: &dueBefore}, []int{1, 5}},
+		{"search", Query{Search: "RELEASE"}, []int{4, 5}},
+		{"every word", Query{Search: "release notes"}, []int{4}},
+		{"combined", Query{Pending: true, Tags: []string{"work"}, Search: "release"}, []int{4, 5}},
+		{"nothing", Query{Done: true, Tags: []string{"home"}}, nil},
+	}
+	todos := querySample()
+	for _, tt := range tests {
+		result, err := todos.Query(tt.q)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var ids []int
+		for _, item := range result.Items {
+			ids = append(ids, item.ID)
+		}
+		// Created order, the default, is ID order here.
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+}
+
+func TestQuerySort(t *testing.T) {
+	tests := []struct {
+		sortBy  string
+		reverse bool
+		want    []int
+	}{
+		{"", false, []int{1, 2, 3, 4, 5}},
+		{"created", false, []int{1, 2, 3, 4, 5}},
+		{"created", true, []int{5, 4, 3, 2, 1}},
+		{"list", false, []int{3, 1, 4, 2, 5}},
+		{"list", true, []int{5, 2, 4, 1, 3}},
+		{"due", false, []int{1, 5, 2, 3, 4}},
+		{"priority", false, []int{3, 1, 5, 4, 2}},
+		{"completed", false, []int{2, 1, 3, 4, 5}},
+	}
+	todos := querySample()
+	for _, tt := range tests {
+		result, err := todos.Query(Query{SortBy: tt.sortBy, Reverse: tt.reverse})
+		if err != nil {
+			t.Fatalf("sort %q: %v", tt.sortBy, err)
+		}
+		var ids []int
+		for _, item := range result.Items {
+			ids = append(ids, item.ID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("sort %q (reverse %v): %v, want %v", tt.sortBy, tt.reverse, ids, tt.want)
+		}
+	}
+	if _, err := todos.Query(Query{SortBy: "title"}); err == nil {
+		t.Error("Query accepted an unknown sort key")
+	}
+}
+
+func TestQueryCopiesTodos(t *testing.T) {
+	todos := querySample()
+	result, _ := todos.Query(Query{Tags: []string{"work"}})
+	result.Items[0].Title = "changed"
+	if got, _ := todos.Get(result.Items[0].ID); got.Title == "changed" {
+		t.Error("changing a query result changed the list")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// `todo add` reads fields from the title the way people type them:
+//
+//	todo add Pay invoice tomorrow 5pm #finance !high every month
+//
+// #tags and !priority are picked up anywhere. Dates, times and repeat rules
+// are only read from the end of the text, so titles such as "Write monthly
+// report" or "Sunday roast" stay as they are; the parser stops at the first
+// word from the end it doesn't understand. Nothing depends on the locale or
+// a network service, so the same text and time always give the same todo.
+
+// QuickAdd is what was read from a quick-add title.
+type QuickAdd struct {
+	Title    string
+	Due      *time.Time
+	Priority Priority
+	Tags     []string
+	Repeat   *Recurrence
+}
+
+var (
+	quickTag   = regexp.MustCompile(`^#[A-Za-z][A-Za-z0-9_-]*$`)
+	quickClock = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+)
+
+// parseClock reads a time of day such as "5pm", "5:30pm" or "17:00" and
+// returns it as an offset from midnight. A bare number isn't a time.
+func parseClock(s string) (time.Duration, bool) {
+	if s == "noon" {
+		return 12 * time.Hour, true
+	}
+	m := quickClock.FindStringSubmatch(s)
+	if m == nil || (m[2] == "" && m[3] == "") {
+		return 0, false
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi(m[2])
+	switch {
+	case minute > 59:
+		return 0, false
+	case m[3] != "":
+		if hour < 1 || hour > 12 {
+			return 0, false
+		}
+		hour %= 12
+		if m[3] == "pm" {
+			hour += 12
+		}
+	case hour > 23:
+		return 0, false
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, true
+}
+
+// ParseQuickAdd reads the fields out of a quick-add title as of now.
+func ParseQuickAdd(text string, now time.Time) QuickAdd {
+	var q QuickAdd
+	var words []string
+	for _, word := range strings.Fields(text) {
+		switch {
+		case quickTag.MatchString(word):
+			q.Tags = append(q.Tags, normalizeTag(word))
+		case len(word) > 1 && word[0] == '!':
+			if p, err := ParsePriority(word[1:]); err == nil && p != PriorityNone && q.Priority == PriorityNone {
+				q.Priority = p
+				continue
+			}
+			words = append(words, word)
+		default:
+			words = append(words, word)
+		}
+	}
+
+	var date *time.Time
+	var clock time.Duration
+	var hasClock bool
+	last := "" // kind of the phrase read just after the current position
+	lower := func(i int) string { return strings.ToLower(words[i]) }
+
+	end := len(words)
+scan:
+	for end > 0 {
+		// A repeat rule, longest first: "every 2 weeks", "weekly on mon,thu".
+		if q.Repeat == nil {
+			for k := min(end, 6); k >= 1; k-- {
+				first := lower(end - k)
+				if first != "every" && first != "daily" && first != "weekly" && first != "monthly" {
+					continue
+				}
+				if r, err := ParseRecurrence(strings.Join(words[end-k:end], " ")); err == nil {
+					q.Repeat = r
+					end -= k
+					last = "repeat"
+					continue scan
+				}
+			}
+		}
+		word := lower(end - 1)
+		if !hasClock {
+			if d, ok := parseClock(word); ok {
+				clock, hasClock = d, true
+				end--
+				last = "time"
+				continue
+			}
+			if (word == "am" || word == "pm") && end >= 2 {
+				if d, ok := parseClock(lower(end-2) + word); ok {
+					clock, hasClock = d, true
+					end -= 2
+					last = "time"
+					continue
+				}
+			}
+		}
+		if date == nil {
+			// "in 3 days", "in 2 weeks".
+			if end >= 3 && lower(end-3) == "in" {
+				unit := strings.TrimSuffix(word, "s")
+				if n, err := strconv.Atoi(lower(end - 2)); err == nil && n > 0 && (unit == "day" || unit == "week" || unit == "month") {
+					d, _ := ParseDue("+"+strconv.Itoa(n)+unit[:1], now)
+					date = &d
+					end -= 3
+					last = "date"
+					continue
+				}
+			}
+			if d, err := ParseDue(word, now); err == nil {
+				date = &d
+				end--
+				last = "date"
+				if _, weekday := parseWeekday(word); weekday && end > 0 && lower(end-1) == "next" {
+					end--
+				}
+				continue
+			}
+		}
+		switch {
+		case (word == "at" || word == "@") && last == "time",
+			(word == "on" || word == "by" || word == "due") && last == "date":
+			end--
+			last = ""
+			continue
+		}
+		break
+	}
+	q.Title = strings.Join(words[:end], " ")
+
+	switch {
+	case date == nil && hasClock:
+		// A time alone means the next time the clock shows it.
+		d := startOfDay(now).Add(clock)
+		if !d.After(now) {
+			d = startOfDay(now).AddDate(0, 0, 1).Add(clock)
+		}
+		date = &d
+	case date == nil && q.Repeat != nil && (len(q.Repeat.Weekdays) > 0 || q.Repeat.MonthDay > 0):
+		// "every monday" is first due on the next monday, today included.
+		d := q.Repeat.Next(startOfDay(now).AddDate(0, 0, -1))
+		date = &d
+	case date != nil && hasClock:
+		d := startOfDay(*date).Add(clock)
+		date = &d
+	}
+	q.Due = date
+	return q
+}
+
+// Found reports whether anything besides the title was read.
+func (q QuickAdd) Found() bool {
+	return q.Due != nil || q.Priority != PriorityNone || len(q.Tags) > 0 || q.Repeat != nil
+}
+
+// String describes what was read, for the feedback `todo add` prints.
+func (q QuickAdd) String() string {
+	parts := []string{fmt.Sprintf("%q", q.Title)}
+	if q.Due != nil {
+		parts = append(parts, "due "+formatDue(*q.Due))
+	}
+	if q.Priority != PriorityNone {
+		parts = append(parts, "priority "+q.Priority.String())
+	}
+	for _, tag := range q.Tags {
+		parts = append(parts, "#"+tag)
+	}
+	if q.Repeat != nil {
+		parts = append(parts, "repeats "+q.Repeat.String())
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseQuickAdd(t *testing.T) {
+	// A Wednesday afternoon.
+	now := time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC)
+	at := func(month time.Month, d, hour, minute int) *time.Time {
+		due := time.Date(2026, month, d, hour, minute, 0, 0, time.UTC)
+		return &due
+	}
+	tests := []struct {
+		in       string
+		title    string
+		due      *time.Time
+		priority Priority
+		tags     []string
+		repeat   string
+	}{
+		{"Pay invoice tomorrow 5pm #finance !high every month", "Pay invoice", at(10, 15, 17, 0), PriorityHigh, []string{"finance"}, "monthly"},
+		{"Write monthly report", "Write monthly report", nil, PriorityNone, nil, ""},
+		{"Sunday roast", "Sunday roast", nil, PriorityNone, nil, ""},
+		{"Fix #42 in parser", "Fix #42 in parser", nil, PriorityNone, nil, ""},
+		{"Email !nope", "Email !nope", nil, PriorityNone, nil, ""},
+		{"#Home Water plants !low", "Water plants", nil, PriorityLow, []string{"home"}, ""},
+		{"Call the bank 5pm", "Call the bank", at(10, 14, 17, 0), PriorityNone, nil, ""},
+		{"Call the bank 9am", "Call the bank", at(10, 15, 9, 0), PriorityNone, nil, ""}, // already past today
+		{"Call the bank at 5 pm", "Call the bank", at(10, 14, 17, 0), PriorityNone, nil, ""},
+		{"Gym every monday", "Gym", at(10, 19, 0, 0), PriorityNone, nil, "weekly on Mon"},
+		{"Review every wednesday", "Review", at(10, 14, 0, 0), PriorityNone, nil, "weekly on Wed"},
+		{"Renew passport in 2 weeks", "Renew passport", at(10, 28, 0, 0), PriorityNone, nil, ""},
+		{"Standup next tue at 10:30", "Standup", at(10, 20, 10, 30), PriorityNone, nil, ""},
+		{"Dentist on friday", "Dentist", at(10, 16, 0, 0), PriorityNone, nil, ""},
+		{"Water plants every 3 days", "Water plants", nil, PriorityNone, nil, "every 3 days"},
+	}
+	for _, tt := range tests {
+		q := ParseQuickAdd(tt.in, now)
+		if q.Title != tt.title {
+			t.Errorf("%q: title %q, want %q", tt.in, q.Title, tt.title)
+		}
+		switch {
+		case (q.Due == nil) != (tt.due == nil):
+			t.Errorf("%q: due %v, want %v", tt.in, q.Due, tt.due)
+		case q.Due != nil && !q.Due.Equal(*tt.due):
+			t.Errorf("%q: due %v, want %v", tt.in, *q.Due, *tt.due)
+		}
+		if q.Priority != tt.priority {
+			t.Errorf("%q: priority %v, want %v", tt.in, q.Priority, tt.priority)
+		}
+		if !slices.Equal(q.Tags, tt.tags) {
+			t.Errorf("%q: tags %v, want %v", tt.in, q.Tags, tt.tags)
+		}
+		repeat := ""
+		if q.Repeat != nil {
+			repeat = q.Repeat.String()
+		}
+		if repeat != tt.repeat {
+			t.Errorf("%q: repeat %q, want %q", tt.in, repeat, tt.repeat)
+		}
+		if found := tt.due != nil || tt.priority != PriorityNone || tt.tags != nil || tt.repeat != ""; q.Found() != found {
+			t.Errorf("%q: Found() = %v, want %v", tt.in, q.Found(), found)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence says how often a todo repeats. Every is the interval in units
+// of Freq (every 2 weeks, every 3 days); Weekdays only applies to weekly
+// rules and MonthDay to monthly ones, where 0 means "the day it was due"
+// until the first occurrence records that day.
+type Recurrence struct {
+	Freq     string // daily, weekly or monthly
+	Every    int
+	Weekdays []time.Weekday `json:",omitempty"`
+	MonthDay int            `json:",omitempty"`
+}
+
+// ParseRecurrence understands "daily", "weekly", "monthly", "weekly on
+// mon,thu" (or "weekly mon,thu"), "monthly on 15", "every 3 days", "every 2
+// weeks", "every month" and "every monday".
+func ParseRecurrence(s string) (*Recurrence, error) {
+	fields := strings.Fields(strings.ToLower(strings.ReplaceAll(s, ",", " ")))
+	invalid := fmt.Errorf("invalid repeat rule %q (try daily, weekly on mon,thu, monthly on 15 or every 3 days)", s)
+	if len(fields) == 0 {
+		return nil, invalid
+	}
+
+	r := &Recurrence{Every: 1}
+	rest := fields[1:]
+	switch fields[0] {
+	case "daily":
+		r.Freq = "daily"
+	case "weekly":
+		r.Freq = "weekly"
+	case "monthly":
+		r.Freq = "monthly"
+	case "every":
+		if len(rest) == 0 {
+			return nil, invalid
+		}
+		if n, err := strconv.Atoi(rest[0]); err == nil {
+			if n < 1 || len(rest) < 2 {
+				return nil, invalid
+			}
+			r.Every = n
+			rest = rest[1:]
+		}
+		unit := strings.TrimSuffix(rest[0], "s")
+		switch {
+		case unit == "day":
+			r.Freq = "daily"
+		case unit == "week":
+			r.Freq = "weekly"
+		case unit == "month":
+			r.Freq = "monthly"
+		default:
+			// "every monday" or "every mon thu".
+			if _, ok := parseWeekday(rest[0]); !ok || r.Every != 1 {
+				return nil, invalid
+			}
+			r.Freq = "weekly"
+			return r, r.parseOn(rest, invalid)
+		}
+		rest = rest[1:]
+	default:
+		return nil, invalid
+	}
+	return r, r.parseOn(rest, invalid)
+}
+
+// parseOn reads the optional "on <weekdays>" or "on <day>" part of a rule.
+func (r *Recurrence) parseOn(rest []string, invalid error) error {
+	if len(rest) > 0 && rest[0] == "on" {
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		return nil
+	}
+	switch r.Freq {
+	case "weekly":
+		for _, name := range rest {
+			day, ok := parseWeekday(name)
+			if !ok {
+				return invalid
+			}
+			if !slices.Contains(r.Weekdays, day) {
+				r.Weekdays = append(r.Weekdays, day)
+			}
+		}
+		slices.Sort(r.Weekdays)
+		return nil
+	case "monthly":
+		if len(rest) != 1 {
+			return invalid
+		}
+		day, err := strconv.Atoi(strings.TrimRight(rest[0], "stndrh"))
+		if err != nil || day < 1 || day > 31 {
+			return invalid
+		}
+		r.MonthDay = day
+		return nil
+	}
+	return invalid
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if s == name || (len(s) >= 3 && strings.HasPrefix(name, s)) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+func (r *Recurrence) String() string {
+	var b strings.Builder
+	units := map[string]string{"daily": "days", "weekly": "weeks", "monthly": "months"}
+	if r.Every > 1 {
+		fmt.Fprintf(&b, "every %d %s", r.Every, units[r.Freq])
+	} else {
+		b.WriteString(r.Freq)
+	}
+	if len(r.Weekdays) > 0 {
+		names := make([]string, len(r.Weekdays))
+		for i, day := range r.Weekdays {
+			names[i] = day.String()[:3]
+		}
+		b.WriteString(" on " + strings.Join(names, ","))
+	}
+	if r.MonthDay > 0 {
+		fmt.Fprintf(&b, " on day %d", r.MonthDay)
+	}
+	return b.String()
+}
+
+// Next returns the first occurrence after t, keeping t's time of day.
+func (r *Recurrence) Next(t time.Time) time.Time {
+	every := max(r.Every, 1)
+	switch r.Freq {
+	case "weekly":
+		if len(r.Weekdays) == 0 {
+			return t.AddDate(0, 0, 7*every)
+		}
+		for i := 1; i <= 7; i++ {
+			next := t.AddDate(0, 0, i)
+			if slices.Contains(r.Weekdays, next.Weekday()) {
+				// Wrapping into the next week skips the weeks in between.
+				if next.Weekday() <= t.Weekday() {
+					next = next.AddDate(0, 0, 7*(every-1))
+				}
+				return next
+			}
+		}
+	case "monthly":
+		day := r.MonthDay
+		if day == 0 {
+			day = t.Day()
+		}
+		months := 0
+		for {
+			next := dayOfMonth(t, months, day)
+			if next.After(t) {
+				return next
+			}
+			months += every
+		}
+	}
+	return t.AddDate(0, 0, every)
+}
+
+// dayOfMonth returns the given day in the month that is months after t,
+// clamped to the last day of short months.
+func dayOfMonth(t time.Time, months, day int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(day, last)-1)
+}
+
+// nextDue picks the due time of the occurrence that follows a todo completed
+// at done. It counts from the old due time (or the completion day when there
+// was none) and skips occurrences that would already be in the past.
+func (r *Recurrence) nextDue(due *time.Time, done time.Time) time.Time {
+	base := startOfDay(done)
+	if due != nil {
+		base = *due
+	}
+	tomorrow := startOfDay(done).AddDate(0, 0, 1)
+	next := r.Next(base)
+	for next.Before(tomorrow) {
+		next = r.Next(next)
+	}
+	return next
+}
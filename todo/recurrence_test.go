@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // as printed by String
+	}{
+		{"daily", "daily"},
+		{"Weekly", "weekly"},
+		{"monthly", "monthly"},
+		{"weekly on mon,thu", "weekly on Mon,Thu"},
+		{"weekly thu mon", "weekly on Mon,Thu"},
+		{"monthly on 15", "monthly on day 15"},
+		{"monthly on 1st", "monthly on day 1"},
+		{"every 3 days", "every 3 days"},
+		{"every 2 weeks on fri", "every 2 weeks on Fri"},
+		{"every month", "monthly"},
+		{"every monday", "weekly on Mon"},
+		{"every mon thu", "weekly on Mon,Thu"},
+	}
+	for _, tt := range tests {
+		r, err := ParseRecurrence(tt.in)
+		if err != nil {
+			t.Errorf("ParseRecurrence(%q): %v", tt.in, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("ParseRecurrence(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"", "hourly", "every", "every 0 days", "every 2 mondays", "monthly on 32", "daily on mon", "weekly on funday"} {
+		if r, err := ParseRecurrence(in); err == nil {
+			t.Errorf("ParseRecurrence(%q) = %v, want an error", in, r)
+		}
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 9, 30, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		rule string
+		from time.Time
+		want time.Time
+	}{
+		{"daily", date(2026, 10, 14), date(2026, 10, 15)},
+		{"every 3 days", date(2026, 10, 30), date(2026, 11, 2)},
+		{"weekly", date(2026, 10, 14), date(2026, 10, 21)},
+		{"weekly on mon,thu", date(2026, 10, 14), date(2026, 10, 15)}, // Wed → Thu
+		{"weekly on mon,thu", date(2026, 10, 15), date(2026, 10, 19)}, // Thu → Mon
+		{"every 2 weeks on mon,thu", date(2026, 10, 15), date(2026, 10, 26)},
+		{"monthly", date(2026, 10, 14), date(2026, 11, 14)},
+		{"monthly on 15", date(2026, 10, 14), date(2026, 10, 15)},
+		{"monthly on 15", date(2026, 10, 15), date(2026, 11, 15)},
+		{"monthly on 31", date(2027, 1, 31), date(2027, 2, 28)},
+		{"monthly on 31", date(2027, 2, 28), date(2027, 3, 31)},
+		{"every 3 months", date(2026, 11, 30), date(2027, 2, 28)},
+	}
+	for _, tt := range tests {
+		r, err := ParseRecurrence(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q after %s = %s, want %s", tt.rule, tt.from.Format(time.DateOnly), got.Format(time.DateOnly), tt.want.Format(time.DateOnly))
+		}
+	}
+}
+
+// Completing a monthly todo due on the 31st must not drift to the 28th
+// after February.
+func TestMonthlyOccurrencesKeepTheirDay(t *testing.T) {
+	var todos Todos
+	id := todos.Add("Rent")
+	due := time.Date(2027, 1, 31, 0, 0, 0, 0, time.Local)
+	todos.SetDue(id, &due)
+	todos.SetRepeat(id, &Recurrence{Freq: "monthly", Every: 1})
+
+	want := []string{"2027-02-28", "2027-03-31", "2027-04-30", "2027-05-31"}
+	for _, w := range want {
+		if err := todos.Toggle(id); err != nil {
+			t.Fatal(err)
+		}
+		done, _ := todos.Get(id)
+		id = done.NextOccurrence
+		next, err := todos.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := next.Due.Format(time.DateOnly); got != w {
+			t.Errorf("next occurrence due %s, want %s", got, w)
+		}
+	}
+}
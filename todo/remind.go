@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Reminder is one notification about a pending todo that is coming due
+// ("due") or past its due time ("overdue").
+type Reminder struct {
+	List string
+	Todo Todo
+	Kind string
+}
+
+func (r Reminder) Subject() string {
+	if r.Kind == "overdue" {
+		return "Overdue: " + r.Todo.Title
+	}
+	return "Due soon: " + r.Todo.Title
+}
+
+func (r Reminder) Message() string {
+	verb := "is due"
+	if r.Kind == "overdue" {
+		verb = "was due"
+	}
+	msg := fmt.Sprintf("Todo %d %q %s %s.", r.Todo.ID, r.Todo.Title, verb, formatDue(*r.Todo.Due))
+	if r.List != "" {
+		msg += fmt.Sprintf(" (list %s)", r.List)
+	}
+	return msg
+}
+
+// ReminderSink delivers reminders somewhere a person will see them.
+type ReminderSink interface {
+	Send(r Reminder) error
+}
+
+// StdoutSink prints one line per reminder.
+type StdoutSink struct {
+	W io.Writer
+}
+
+func (s StdoutSink) Send(r Reminder) error {
+	_, err := fmt.Fprintf(s.W, "%s %s: %s\n", time.Now().Format("2006-01-02 15:04"), r.Kind, r.Message())
+	return err
+}
+
+// DesktopSink shows a desktop notification with notify-send.
+type DesktopSink struct{}
+
+func (DesktopSink) Send(r Reminder) error {
+	urgency := "normal"
+	if r.Kind == "overdue" {
+		urgency = "critical"
+	}
+	out, err := exec.Command("notify-send", "-a", "todo", "-u", urgency, r.Subject(), r.Message()).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("notify-send: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// WebhookSink posts each reminder as JSON to a URL.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s WebhookSink) Send(r Reminder) error {
+	body, err := json.Marshal(map[string]any{
+		"list":    r.List,
+		"kind":    r.Kind,
+		"subject": r.Subject(),
+		"message": r.Message(),
+		"todo":    newTodoView(r.Todo, time.Now()),
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: %s", s.URL, resp.Status)
+	}
+	return nil
+}
+
+// SMTPSink mails each reminder. Auth may be nil for servers that don't need
+// it, such as a local relay or test server.
+type SMTPSink struct {
+	Addr string
+	From string
+	To   []string
+	Auth smtp.Auth
+}
+
+func (s SMTPSink) Send(r Reminder) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", r.Subject()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(r.Message() + "\r\n")
+	return smtp.SendMail(s.Addr, s.Auth, s.From, s.To, msg.Bytes())
+}
+
+var sinkNames = []string{"stdout", "desktop", "webhook", "smtp"}
+
+// sinkOptions are the flags that pick and configure the reminder sinks.
+type sinkOptions struct {
+	sinks    stringList
+	webhook  string
+	smtpAddr string
+	smtpFrom string
+	smtpTo   stringList
+	smtpUser string
+}
+
+func (o *sinkOptions) register(fs *flag.FlagSet) {
+	fs.Var(&o.sinks, "sink", "where to send reminders: "+strings.Join(sinkNames, ", ")+" (repeatable; default stdout)")
+	fs.StringVar(&o.webhook, "webhook", "", "URL the webhook sink posts to")
+	fs.StringVar(&o.smtpAddr, "smtp", "", "host:port of the SMTP server for the smtp sink")
+	fs.StringVar(&o.smtpFrom, "smtp-from", "todo@localhost", "sender address for the smtp sink")
+	fs.Var(&o.smtpTo, "smtp-to", "recipient address for the smtp sink (repeatable)")
+	fs.StringVar(&o.smtpUser, "smtp-user", "", "SMTP user name; the password is read from TODO_SMTP_PASSWORD")
+}
+
+// open builds the selected sinks, checking that each has what it needs.
+func (o *sinkOptions) open() ([]ReminderSink, error) {
+	names := o.sinks
+	if len(names) == 0 {
+		names = stringList{"stdout"}
+	}
+	var sinks []ReminderSink
+	for _, name := range names {
+		switch name {
+		case "stdout":
+			sinks = append(sinks, StdoutSink{W: os.Stdout})
+		case "desktop":
+			if _, err := exec.LookPath("notify-send"); err != nil {
+				return nil, errors.New("the desktop sink needs notify-send")
+			}
+			sinks = append(sinks, DesktopSink{})
+		case "webhook":
+			if o.webhook == "" {
+				return nil, errors.New("the webhook sink needs -webhook")
+			}
+			sinks = append(sinks, WebhookSink{URL: o.webhook, Client: &http.Client{Timeout: 30 * time.Second}})
+		case "smtp":
+			if o.smtpAddr == "" || len(o.smtpTo) == 0 {
+				return nil, errors.New("the smtp sink needs -smtp and -smtp-to")
+			}
+			sink := SMTPSink{Addr: o.smtpAddr, From: o.smtpFrom, To: o.smtpTo}
+			if o.smtpUser != "" {
+				host, _, err := net.SplitHostPort(o.smtpAddr)
+				if err != nil {
+					return nil, fmt.Errorf("invalid -smtp address: %w", err)
+				}
+				sink.Auth = smtp.PlainAuth("", o.smtpUser, os.Getenv("TODO_SMTP_PASSWORD"), host)
+			}
+			sinks = append(sinks, sink)
+		default:
+			return nil, fmt.Errorf("unknown sink %q (use %s)", name, strings.Join(sinkNames, ", "))
+		}
+	}
+	return sinks, nil
+}
+
+// ReminderState is kept next to a list in its ".reminders" file. Sent holds
+// the last reminder sent for each todo, so a todo is reminded once when it
+// comes due and once when it becomes overdue, and again only if its due time
+// changes. Snoozed holds the todos that get no reminders until a time.
+type ReminderState struct {
+	Sent    map[int]SentReminder `json:",omitempty"`
+	Snoozed map[int]time.Time    `json:",omitempty"`
+}
+
+type SentReminder struct {
+	Kind string
+	Due  time.Time
+	At   time.Time
+}
+
+// Pending returns the reminders that are due now for the list. ahead is how
+// long before its due time a todo counts as coming due.
+func (s *ReminderState) Pending(list string, todos *Todos, now time.Time, ahead time.Duration) []Reminder {
+	var reminders []Reminder
+	for _, t := range todos.Items {
+		if t.Completed || t.Due == nil {
+			continue
+		}
+		if until, ok := s.Snoozed[t.ID]; ok && now.Before(until) {
+			continue
+		}
+		kind := ""
+		switch {
+		case t.IsOverdue(now):
+			kind = "overdue"
+		case !now.Add(ahead).Before(*t.Due):
+			kind = "due"
+		default:
+			continue
+		}
+		sent, ok := s.Sent[t.ID]
+		if ok && sent.Due.Equal(*t.Due) && (sent.Kind == kind || sent.Kind == "overdue") {
+			continue
+		}
+		reminders = append(reminders, Reminder{List: list, Todo: t, Kind: kind})
+	}
+	return reminders
+}
+
+func (s *ReminderState) MarkSent(r Reminder, now time.Time) {
+	if s.Sent == nil {
+		s.Sent = make(map[int]SentReminder)
+	}
+	s.Sent[r.Todo.ID] = SentReminder{Kind: r.Kind, Due: *r.Todo.Due, At: now}
+}
+
+// Snooze holds back reminders for a todo until the given time. Whatever was
+// already sent for it is forgotten, so it is reminded again afterwards.
+func (s *ReminderState) Snooze(id int, until time.Time) {
+	if s.Snoozed == nil {
+		s.Snoozed = make(map[int]time.Time)
+	}
+	s.Snoozed[id] = until
+	delete(s.Sent, id)
+}
+
+func (s *ReminderState) Unsnooze(id int) {
+	delete(s.Snoozed, id)
+}
+
+// prune forgets todos that were deleted or completed and snoozes that ran
+// out. Todos created after the list was loaded are left alone.
+func (s *ReminderState) prune(todos *Todos, now time.Time) {
+	keep := func(id int) bool {
+		if id >= todos.NextID {
+			return true
+		}
+		t, err := todos.Get(id)
+		return err == nil && !t.Completed
+	}
+	for id := range s.Sent {
+		if !keep(id) {
+			delete(s.Sent, id)
+		}
+	}
+	for id, until := range s.Snoozed {
+		if !keep(id) || !now.Before(until) {
+			delete(s.Snoozed, id)
+		}
+	}
+}
+
+// remindList sends the pending reminders for one list. The list is only
+// locked while reading it and while recording what was sent, not while the
+// sinks run. A reminder counts as sent once every sink took it; otherwise it
+// is tried again on the next scan.
+func remindList(name, file string, sinks []ReminderSink, ahead time.Duration) error {
+	store, err := openStore(options.Store, file)
+	if err != nil {
+		return err
+	}
+	stateStorage := NewStorage[ReminderState](remindersFileName(file))
+
+	var todos Todos
+	var state ReminderState
+	now := time.Now()
+	err = withLock(store, func() error {
+		if err := store.Load(&todos); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := stateStorage.Load(&state); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	var delivered []Reminder
+	for _, r := range state.Pending(name, &todos, now, ahead) {
+		ok := true
+		for _, sink := range sinks {
+			if err := sink.Send(r); err != nil {
+				errs = append(errs, fmt.Errorf("todo %d: %w", r.Todo.ID, err))
+				ok = false
+			}
+		}
+		if ok {
+			delivered = append(delivered, r)
+		}
+	}
+
+	err = withLock(store, func() error {
+		// Reload, as `todo snooze` may have run while the sinks did.
+		state = ReminderState{}
+		if err := stateStorage.Load(&state); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		for _, r := range delivered {
+			if until, ok := state.Snoozed[r.Todo.ID]; !ok || !now.Before(until) {
+				state.MarkSent(r, now)
+			}
+		}
+		before := len(state.Sent) + len(state.Snoozed)
+		state.prune(&todos, now)
+		if len(delivered) == 0 && before == len(state.Sent)+len(state.Snoozed) {
+			return nil
+		}
+		return stateStorage.Save(state)
+	})
+	return errors.Join(append(errs, err)...)
+}
+
+// withLock runs fn while holding the store's lock.
+func withLock(store Store[Todos], fn func() error) error {
+	unlock, err := store.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
+
+type remindTarget struct {
+	Name string // shown in reminders; empty for a single list
+	File string
+}
+
+// remindTargets returns the lists `todo remind` scans.
+func remindTargets(all bool) ([]remindTarget, error) {
+	if !all {
+		return []remindTarget{{File: options.File}}, nil
+	}
+	if err := options.requireLists(); err != nil {
+		return nil, err
+	}
+	names, err := listNames(options.Dir, options.Store)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]remindTarget, 0, len(names))
+	for _, name := range names {
+		targets = append(targets, remindTarget{Name: name, File: listFile(options.Dir, name, options.Store)})
+	}
+	return targets, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+// remindSample is a list as of a Wednesday at 15:30 with todos in every
+// state a reminder cares about.
+func remindSample() (Todos, time.Time) {
+	now := time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC)
+	at := func(day, hour int) *time.Time {
+		t := time.Date(2026, 10, day, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+	todos := Todos{NextID: 8, Items: []Todo{
+		{ID: 1, Title: "Soon", Due: at(14, 16)},
+		{ID: 2, Title: "Later", Due: at(14, 18)},
+		{ID: 3, Title: "Late", Due: at(14, 14)},
+		{ID: 4, Title: "Yesterday", Due: at(13, 0)},
+		{ID: 5, Title: "Today", Due: at(14, 0)},
+		{ID: 6, Title: "Done", Due: at(14, 14), Completed: true},
+		{ID: 7, Title: "Someday"},
+	}}
+	return todos, now
+}
+
+func TestPendingReminders(t *testing.T) {
+	todos, now := remindSample()
+	due := func(id int) time.Time {
+		t, _ := todos.Get(id)
+		return *t.Due
+	}
+	tests := []struct {
+		name  string
+		state ReminderState
+		want  map[int]string
+	}{
+		{"nothing sent", ReminderState{}, map[int]string{1: "due", 3: "overdue", 4: "overdue", 5: "due"}},
+		{"already sent", ReminderState{Sent: map[int]SentReminder{
+			1: {Kind: "due", Due: due(1)},
+			3: {Kind: "overdue", Due: due(3)},
+			4: {Kind: "overdue", Due: due(4)},
+			5: {Kind: "due", Due: due(5)},
+		}}, map[int]string{}},
+		{"due sent, now overdue", ReminderState{Sent: map[int]SentReminder{
+			3: {Kind: "due", Due: due(3)},
+		}}, map[int]string{1: "due", 3: "overdue", 4: "overdue", 5: "due"}},
+		{"due time changed", ReminderState{Sent: map[int]SentReminder{
+			1: {Kind: "due", Due: due(1).Add(-time.Hour)},
+			3: {Kind: "overdue", Due: due(3).Add(-24 * time.Hour)},
+		}}, map[int]string{1: "due", 3: "overdue", 4: "overdue", 5: "due"}},
+		{"snoozed", ReminderState{Snoozed: map[int]time.Time{
+			1: now.Add(time.Hour),
+			3: now.Add(-time.Minute), // ran out
+			4: now,                   // runs out now
+		}}, map[int]string{3: "overdue", 4: "overdue", 5: "due"}},
+	}
+	for _, tt := range tests {
+		got := make(map[int]string)
+		for _, r := range tt.state.Pending("work", &todos, now, time.Hour) {
+			if r.List != "work" {
+				t.Errorf("%s: reminder for list %q", tt.name, r.List)
+			}
+			got[r.Todo.ID] = r.Kind
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("%s: reminders %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRemindOnce(t *testing.T) {
+	todos, now := remindSample()
+	var state ReminderState
+	pending := func(at time.Time) []int {
+		var ids []int
+		for _, r := range state.Pending("", &todos, at, time.Hour) {
+			ids = append(ids, r.Todo.ID)
+		}
+		return ids
+	}
+
+	for _, r := range state.Pending("", &todos, now, time.Hour) {
+		state.MarkSent(r, now)
+	}
+	if ids := pending(now.Add(5 * time.Minute)); len(ids) != 0 {
+		t.Errorf("reminded %v again", ids)
+	}
+	// Soon becomes overdue at 16:00 and is reminded once more.
+	if ids := pending(now.Add(time.Hour)); !slices.Equal(ids, []int{1}) {
+		t.Errorf("an hour later reminded %v, want [1]", ids)
+	}
+
+	// A snoozed todo is quiet until the snooze runs out, then reminded again.
+	state.Snooze(3, now.Add(2*time.Hour))
+	if ids := pending(now.Add(time.Hour + 59*time.Minute)); slices.Contains(ids, 3) {
+		t.Error("reminded a snoozed todo")
+	}
+	if ids := pending(now.Add(2 * time.Hour)); !slices.Contains(ids, 3) {
+		t.Errorf("after the snooze reminded %v, want 3 among them", ids)
+	}
+	state.Snooze(4, now.Add(2*time.Hour))
+	state.Unsnooze(4)
+	if ids := pending(now.Add(time.Minute)); !slices.Contains(ids, 4) {
+		t.Errorf("after unsnoozing reminded %v, want 4 among them", ids)
+	}
+}
+
+func TestPruneReminderState(t *testing.T) {
+	todos, now := remindSample()
+	todos.Delete(2)
+	sent := SentReminder{Kind: "due"}
+	state := ReminderState{
+		Sent: map[int]SentReminder{1: sent, 2: sent, 6: sent, 9: sent},
+		Snoozed: map[int]time.Time{
+			1: now.Add(time.Hour),
+			3: now.Add(-time.Hour),
+			5: now,
+			6: now.Add(time.Hour),
+			9: now.Add(time.Hour),
+		},
+	}
+	state.prune(&todos, now)
+	// 2 was deleted, 6 is done, 9 was added after the list was loaded.
+	if got := slices.Sorted(maps.Keys(state.Sent)); !slices.Equal(got, []int{1, 9}) {
+		t.Errorf("kept sent reminders for %v, want [1 9]", got)
+	}
+	if got := slices.Sorted(maps.Keys(state.Snoozed)); !slices.Equal(got, []int{1, 9}) {
+		t.Errorf("kept snoozes for %v, want [1 9]", got)
+	}
+}
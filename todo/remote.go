@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RemoteStore is a Store backed by a `todo serve` instance, so every CLI
+// command works against a shared list. Save sends only the todos that
+// changed, together with the ETags they had when loaded; if someone else
+// changed one of them in between, the server rejects the whole save.
+type RemoteStore struct {
+	URL    string
+	Client *http.Client
+
+	nextID int
+	etags  map[int]string
+}
+
+func NewRemoteStore(url string) *RemoteStore {
+	return &RemoteStore{
+		URL:    strings.TrimRight(url, "/"),
+		Client: &http.Client{Timeout: 30 * time.Second},
+		etags:  make(map[int]string),
+	}
+}
+
+var errRemoteConflict = errors.New("the list was changed on the server since it was loaded; run the command again")
+
+func (s *RemoteStore) Load(data *Todos) error {
+	resp, err := s.Client.Get(s.URL + "/sync")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := remoteError(resp); err != nil {
+		return err
+	}
+	var list syncList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return fmt.Errorf("reading %s: %w", s.URL, err)
+	}
+
+	*data = Todos{NextID: list.NextID, Items: list.Items}
+	data.ensureIDs()
+	s.nextID = list.NextID
+	s.etags = make(map[int]string, len(list.Items))
+	for _, t := range list.Items {
+		s.etags[t.ID] = todoETag(t)
+	}
+	return nil
+}
+
+func (s *RemoteStore) Save(data Todos) error {
+	req := syncRequest{BaseNextID: s.nextID, NextID: data.NextID}
+	kept := make(map[int]bool, len(data.Items))
+	for i, t := range data.Items {
+		kept[t.ID] = true
+		etag, known := s.etags[t.ID]
+		if !known || etag != todoETag(t) {
+			req.Changes = append(req.Changes, syncChange{ID: t.ID, IfMatch: etag, Todo: &data.Items[i]})
+		}
+	}
+	for id, etag := range s.etags {
+		if !kept[id] {
+			req.Changes = append(req.Changes, syncChange{ID: id, IfMatch: etag})
+		}
+	}
+	if len(req.Changes) == 0 && data.NextID == s.nextID {
+		return nil
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Post(s.URL+"/sync", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return errRemoteConflict
+	}
+	if err := remoteError(resp); err != nil {
+		return err
+	}
+
+	s.nextID = data.NextID
+	s.etags = make(map[int]string, len(data.Items))
+	for _, t := range data.Items {
+		s.etags[t.ID] = todoETag(t)
+	}
+	return nil
+}
+
+// Lock does nothing: the server locks its store for each request and the
+// ETags catch changes made between Load and Save.
+func (s *RemoteStore) Lock() (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+// remoteError turns an error response into an error, using the message the
+// server sent when there is one.
+func remoteError(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		return fmt.Errorf("server: %s", body.Error)
+	}
+	return fmt.Errorf("server: %s", resp.Status)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// A versioned file wraps its data in an envelope recording the format
+// version it was written with:
+//
+//	{"version": 3, "data": ...}
+//
+// Loading a file from an older version runs it through the migrations up to
+// the current one. Saving refuses to overwrite a file from a newer version,
+// whose fields this build would drop, and backs up a file from an older
+// version before replacing it.
+
+// ErrNewerFormat is returned when saving over a file written by a newer
+// version of todo.
+var ErrNewerFormat = errors.New("it was written by a newer version of todo; upgrade todo to change it")
+
+// Schema describes the versions of a file format.
+type Schema struct {
+	Version int
+	// Migrations[i] upgrades the data of a version i file to version i+1.
+	Migrations []func(data json.RawMessage) (json.RawMessage, error)
+	// Legacy returns the version of a file written before the envelope.
+	Legacy func(data []byte) int
+}
+
+type versionedFile struct {
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// unwrap returns the data in a file and the version it was written with.
+func (s *Schema) unwrap(fileData []byte) (json.RawMessage, int) {
+	var f versionedFile
+	if json.Unmarshal(fileData, &f) == nil && f.Version > 0 && f.Data != nil {
+		return f.Data, f.Version
+	}
+	return fileData, s.Legacy(fileData)
+}
+
+// wrap puts data in an envelope for the current version.
+func (s *Schema) wrap(data []byte) ([]byte, error) {
+	return json.MarshalIndent(versionedFile{Version: s.Version, Data: data}, "", "    ")
+}
+
+// migrate upgrades the data of a file written with version to the current
+// version.
+func (s *Schema) migrate(data json.RawMessage, version int) (json.RawMessage, error) {
+	for v := version; v < s.Version; v++ {
+		var err error
+		if data, err = s.Migrations[v](data); err != nil {
+			return nil, fmt.Errorf("upgrading from format version %d: %w", v, err)
+		}
+	}
+	return data, nil
+}
+
+// checkOverwrite is called before a file holding current, decrypted as
+// plain, is replaced. It refuses files from a newer version and copies
+// files from an older one to name.v<version>.bak, unless that backup
+// already exists.
+func (s *Schema) checkOverwrite(name string, current, plain []byte) error {
+	if err := s.checkNewer(name, plain); err != nil {
+		return err
+	}
+	_, version := s.unwrap(plain)
+	if version == s.Version {
+		return nil
+	}
+	backup := name + ".v" + strconv.Itoa(version) + ".bak"
+	if _, err := os.Stat(backup); err == nil {
+		return nil
+	}
+	if err := writeFileAtomic(backup, current, 0600); err != nil {
+		return fmt.Errorf("backing up %s before upgrading it: %w", name, err)
+	}
+	return nil
+}
+
+// checkNewer fails when plain was written by a newer version.
+func (s *Schema) checkNewer(name string, plain []byte) error {
+	if _, version := s.unwrap(plain); version > s.Version {
+		return fmt.Errorf("refusing to overwrite %s (format version %d, this todo writes %d): %w", name, version, s.Version, ErrNewerFormat)
+	}
+	return nil
+}
+
+// todoSchema is the format of todo lists in the json store.
+//
+//	0: a bare array of todos, without IDs
+//	1: {"NextID": ..., "Items": [...]}
+//	2: the envelope, and every todo has a UID
+//	3: todos may have DependsOn
+var todoSchema = &Schema{
+	Version: 3,
+	Migrations: []func(json.RawMessage) (json.RawMessage, error){
+		migrateTodosToObject,
+		migrateTodosToUIDs,
+		addedField,
+	},
+	Legacy: func(data []byte) int {
+		var items []json.RawMessage
+		if json.Unmarshal(data, &items) == nil {
+			return 0
+		}
+		return 1
+	},
+}
+
+// The migrations work on the raw JSON rather than on Todo, so they keep
+// working however Todo changes later.
+
+// addedField is the migration for a version that only adds an optional
+// field: older files are already valid, but older builds must not write
+// the new ones.
+func addedField(data json.RawMessage) (json.RawMessage, error) {
+	return data, nil
+}
+
+func migrateTodosToObject(data json.RawMessage) (json.RawMessage, error) {
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	nextID := 1
+	for _, item := range items {
+		var id int
+		json.Unmarshal(item["ID"], &id)
+		nextID = max(nextID, id+1)
+	}
+	for _, item := range items {
+		var id int
+		if json.Unmarshal(item["ID"], &id); id == 0 {
+			item["ID"], _ = json.Marshal(nextID)
+			nextID++
+		}
+	}
+	if items == nil {
+		items = []map[string]json.RawMessage{}
+	}
+	return json.Marshal(map[string]any{"NextID": nextID, "Items": items})
+}
+
+func migrateTodosToUIDs(data json.RawMessage) (json.RawMessage, error) {
+	var list map[string]json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	var items []map[string]json.RawMessage
+	if list["Items"] != nil {
+		if err := json.Unmarshal(list["Items"], &items); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range items {
+		var uid string
+		if json.Unmarshal(item["UID"], &uid); uid == "" {
+			item["UID"], _ = json.Marshal(newUID())
+		}
+	}
+	var err error
+	if list["Items"], err = json.Marshal(items); err != nil {
+		return nil, err
+	}
+	return json.Marshal(list)
+}
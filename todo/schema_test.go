@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestLoadMigratesOlderFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		version int
+		ids     []int
+		nextID  int
+	}{
+		{"bare array", `[{"Title":"a"},{"Title":"b","Completed":true}]`, 0, []int{1, 2}, 3},
+		{"bare array with IDs", `[{"ID":4,"Title":"a"},{"Title":"b"}]`, 0, []int{4, 5}, 6},
+		{"version 1", `{"NextID":9,"Items":[{"ID":2,"Title":"a"}]}`, 1, []int{2}, 9},
+		{"version 2", `{"version":2,"data":{"NextID":3,"Items":[{"ID":1,"Title":"a","UID":"u1"}]}}`, 2, []int{1}, 3},
+		{"current version", `{"version":3,"data":{"NextID":3,"Items":[{"ID":1,"Title":"a","UID":"u1","DependsOn":[2]},{"ID":2,"Title":"b","UID":"u2"}]}}`, 3, []int{1, 2}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "todos.json")
+			if err := os.WriteFile(file, []byte(tt.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+			store := &Storage[Todos]{FileName: file, Schema: todoSchema}
+			var todos Todos
+			if err := store.Load(&todos); err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, item := range todos.Items {
+				ids = append(ids, item.ID)
+				if item.UID == "" {
+					t.Errorf("todo %d has no UID", item.ID)
+				}
+			}
+			if !slices.Equal(ids, tt.ids) || todos.NextID != tt.nextID {
+				t.Errorf("got IDs %v and NextID %d, want %v and %d", ids, todos.NextID, tt.ids, tt.nextID)
+			}
+
+			// Saving upgrades the file and keeps a backup of an older one.
+			if err := store.Save(todos); err != nil {
+				t.Fatal(err)
+			}
+			data, _ := os.ReadFile(file)
+			var envelope versionedFile
+			if err := json.Unmarshal(data, &envelope); err != nil || envelope.Version != todoSchema.Version {
+				t.Errorf("saved file has version %d (%v), want %d", envelope.Version, err, todoSchema.Version)
+			}
+			backups, _ := filepath.Glob(file + ".v*.bak")
+			switch {
+			case tt.version == todoSchema.Version && len(backups) > 0:
+				t.Errorf("backed up a current file: %v", backups)
+			case tt.version < todoSchema.Version:
+				backup, err := os.ReadFile(file + ".v" + strconv.Itoa(tt.version) + ".bak")
+				if err != nil || string(backup) != tt.file {
+					t.Errorf("backup holds %q (%v), want the original file", backup, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveKeepsFirstBackup(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "todos.json")
+	os.WriteFile(file, []byte(`[{"Title":"first"}]`), 0644)
+	os.WriteFile(file+".v0.bak", []byte("older backup"), 0644)
+	store := &Storage[Todos]{FileName: file, Schema: todoSchema}
+	var todos Todos
+	if err := store.Load(&todos); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(todos); err != nil {
+		t.Fatal(err)
+	}
+	if backup, _ := os.ReadFile(file + ".v0.bak"); string(backup) != "older backup" {
+		t.Errorf("an existing backup was replaced with %q", backup)
+	}
+}
+
+func TestSaveRefusesNewerFormat(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "todos.json")
+	newer := []byte(`{"version":99,"data":{"NextID":2,"Items":[{"ID":1,"Title":"a","FutureField":true}]}}`)
+	os.WriteFile(file, newer, 0644)
+	store := &Storage[Todos]{FileName: file, Schema: todoSchema}
+
+	if err := store.CheckWritable(); !errors.Is(err, ErrNewerFormat) {
+		t.Errorf("CheckWritable: got %v, want ErrNewerFormat", err)
+	}
+	var todos Todos
+	if err := store.Load(&todos); err != nil {
+		t.Fatalf("a newer file should still load for reading: %v", err)
+	}
+	todos.Add("b")
+	if err := store.Save(todos); !errors.Is(err, ErrNewerFormat) {
+		t.Errorf("Save: got %v, want ErrNewerFormat", err)
+	}
+	if data, _ := os.ReadFile(file); !bytes.Equal(data, newer) {
+		t.Error("the newer file was changed")
+	}
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server exposes a todo store over HTTP. Every request locks the store and
+// loads it fresh, so the server and local `todo` commands can share a list.
+//
+//	GET    /todos              list, with the same filters as `todo ls`
+//	POST   /todos              create a todo from a TodoInput
+//	GET    /todos/{id}         one todo
+//	PATCH  /todos/{id}         change the fields given in a TodoInput
+//	POST   /todos/{id}/toggle  flip the completion state
+//	DELETE /todos/{id}         delete a todo and its subtasks
+//	GET    /sync, POST /sync   whole-list access used by `todo -remote`
+//
+// Each todo has an ETag; requests that send If-Match with a stale ETag fail
+// with 412 Precondition Failed instead of overwriting someone else's change.
+// Completing a todo that waits on open todos fails with 409 Conflict unless
+// the request has ?force=true.
+type Server struct {
+	Store   Store[Todos]
+	History *Storage[History]
+}
+
+// TodoInput is the request body of POST /todos and PATCH /todos/{id}. Only
+// the fields that are present are applied; Due and Repeat take the same
+// text as the -due and -repeat flags, and "" clears them.
+type TodoInput struct {
+	Title     *string   `json:"title"`
+	Completed *bool     `json:"completed"`
+	Due       *string   `json:"due"`
+	Priority  *string   `json:"priority"`
+	Tags      *[]string `json:"tags"`
+	Repeat    *string   `json:"repeat"`
+	ParentID  *int      `json:"parent_id"`
+	// DependsOn replaces the todos this one waits on.
+	DependsOn *[]int `json:"depends_on"`
+
+	force bool // from ?force=true
+}
+
+// httpError carries the status code an API error should be reported with.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+var errPreconditionFailed = &httpError{http.StatusPreconditionFailed, "the todo was changed by someone else; fetch it again"}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /todos", s.handleList)
+	mux.HandleFunc("POST /todos", s.handleCreate)
+	mux.HandleFunc("GET /todos/{id}", s.handleGet)
+	mux.HandleFunc("PATCH /todos/{id}", s.handlePatch)
+	mux.HandleFunc("POST /todos/{id}/toggle", s.handleToggle)
+	mux.HandleFunc("DELETE /todos/{id}", s.handleDelete)
+	mux.HandleFunc("GET /sync", s.handleSyncGet)
+	mux.HandleFunc("POST /sync", s.handleSyncPost)
+	return mux
+}
+
+// todoETag identifies one version of a todo.
+func todoETag(t Todo) string {
+	raw, _ := encodeTodo(t)
+	sum := sha256.Sum256([]byte(raw))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// listETag identifies one version of the whole list.
+func listETag(todos Todos) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n", todos.NextID)
+	for _, t := range todos.Items {
+		raw, _ := encodeTodo(t)
+		fmt.Fprintln(h, raw)
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:8]) + `"`
+}
+
+// view loads the store under its lock for a read-only request.
+func (s *Server) view() (Todos, error) {
+	return viewList(s.Store)
+}
+
+// update applies one request's change and records it for undo.
+func (s *Server) update(command string, fn func(todos *Todos) error) error {
+	_, err := updateList(s.Store, s.History, command, fn)
+	return err
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	q, err := queryFromURL(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	todos, err := s.view()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	etag := listETag(todos)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	result, err := todos.Query(q)
+	if err != nil {
+		writeError(w, &httpError{http.StatusBadRequest, err.Error()})
+		return
+	}
+	views := make([]TodoView, len(result.Items))
+	for i, t := range result.Items {
+		views[i] = newTodoView(t, time.Now())
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// queryFromURL reads the ls filters from query parameters: pending, done,
+// actionable, tag (repeatable), priority (repeatable), due_before, search, sort and
+// reverse.
+func queryFromURL(r *http.Request) (Query, error) {
+	v := r.URL.Query()
+	q := Query{
+		Pending:    v.Get("pending") == "true" || v.Get("pending") == "1",
+		Done:       v.Get("done") == "true" || v.Get("done") == "1",
+		Actionable: v.Get("actionable") == "true" || v.Get("actionable") == "1",
+		Tags:       v["tag"],
+		Search:     v.Get("search"),
+		SortBy:     v.Get("sort"),
+		Reverse:    v.Get("reverse") == "true" || v.Get("reverse") == "1",
+	}
+	for _, name := range v["priority"] {
+		p, err := ParsePriority(name)
+		if err != nil {
+			return q, &httpError{http.StatusBadRequest, err.Error()}
+		}
+		q.Priorities = append(q.Priorities, p)
+	}
+	if s := v.Get("due_before"); s != "" {
+		t, err := ParseDue(s, time.Now())
+		if err != nil {
+			return q, &httpError{http.StatusBadRequest, err.Error()}
+		}
+		q.DueBefore = &t
+	}
+	return q, nil
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	todos, err := s.view()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	t, err := todos.Get(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeTodo(w, http.StatusOK, *t)
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var in TodoInput
+	if err := decodeJSON(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	if in.Title == nil || strings.TrimSpace(*in.Title) == "" {
+		writeError(w, &httpError{http.StatusBadRequest, "title is required"})
+		return
+	}
+	var created Todo
+	err := s.update("api create", func(todos *Todos) error {
+		id := todos.Add(strings.TrimSpace(*in.Title))
+		in.Title = nil
+		if err := in.apply(todos, id); err != nil {
+			return err
+		}
+		t, _ := todos.Get(id)
+		created = *t
+		return nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/todos/"+strconv.Itoa(created.ID))
+	writeTodo(w, http.StatusCreated, created)
+}
+
+func (s *Server) handlePatch(w http.ResponseWriter, r *http.Request) {
+	var in TodoInput
+	if err := decodeJSON(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	in.force = forced(r)
+	s.changeTodo(w, r, "api edit", func(todos *Todos, id int) error {
+		return in.apply(todos, id)
+	})
+}
+
+func (s *Server) handleToggle(w http.ResponseWriter, r *http.Request) {
+	s.changeTodo(w, r, "api toggle", func(todos *Todos, id int) error {
+		if t, _ := todos.Get(id); !t.Completed && !forced(r) {
+			if err := todos.checkBlocked(id); err != nil {
+				return err
+			}
+		}
+		return todos.Toggle(id)
+	})
+}
+
+func forced(r *http.Request) bool {
+	v := r.URL.Query().Get("force")
+	return v == "true" || v == "1"
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	err = s.update("api delete", func(todos *Todos) error {
+		if err := checkIfMatch(r, todos, id); err != nil {
+			return err
+		}
+		return todos.Delete(id)
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changeTodo applies fn to the todo named in the path, honouring If-Match,
+// and responds with the changed todo.
+func (s *Server) changeTodo(w http.ResponseWriter, r *http.Request, command string, fn func(todos *Todos, id int) error) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var changed Todo
+	err = s.update(command, func(todos *Todos) error {
+		if err := checkIfMatch(r, todos, id); err != nil {
+			return err
+		}
+		if err := fn(todos, id); err != nil {
+			return err
+		}
+		t, _ := todos.Get(id)
+		changed = *t
+		return nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeTodo(w, http.StatusOK, changed)
+}
+
+func checkIfMatch(r *http.Request, todos *Todos, id int) error {
+	t, err := todos.Get(id)
+	if err != nil {
+		return err
+	}
+	if match := r.Header.Get("If-Match"); match != "" && match != "*" && match != todoETag(*t) {
+		return errPreconditionFailed
+	}
+	return nil
+}
+
+// apply sets the fields present in the input on a todo, using the same
+// methods as the CLI.
+func (in *TodoInput) apply(todos *Todos, id int) error {
+	badRequest := func(err error) error {
+		return &httpError{http.StatusBadRequest, err.Error()}
+	}
+	if in.Title != nil {
+		if strings.TrimSpace(*in.Title) == "" {
+			return badRequest(errors.New("title can't be empty"))
+		}
+		if err := todos.Edit(id, strings.TrimSpace(*in.Title)); err != nil {
+			return err
+		}
+	}
+	if in.Due != nil {
+		var due *time.Time
+		if *in.Due != "" {
+			t, err := ParseDue(*in.Due, time.Now())
+			if err != nil {
+				return badRequest(err)
+			}
+			due = &t
+		}
+		if err := todos.SetDue(id, due); err != nil {
+			return err
+		}
+	}
+	if in.Priority != nil {
+		p, err := ParsePriority(*in.Priority)
+		if err != nil {
+			return badRequest(err)
+		}
+		if err := todos.SetPriority(id, p); err != nil {
+			return err
+		}
+	}
+	if in.Tags != nil {
+		t, _ := todos.Get(id)
+		if err := todos.RemoveTags(id, t.Tags...); err != nil {
+			return err
+		}
+		if err := todos.AddTags(id, *in.Tags...); err != nil {
+			return err
+		}
+	}
+	if in.Repeat != nil {
+		var repeat *Recurrence
+		if *in.Repeat != "" {
+			r, err := ParseRecurrence(*in.Repeat)
+			if err != nil {
+				return badRequest(err)
+			}
+			repeat = r
+		}
+		if err := todos.SetRepeat(id, repeat); err != nil {
+			return err
+		}
+	}
+	if in.ParentID != nil {
+		if err := todos.SetParent(id, *in.ParentID); err != nil {
+			return badRequest(err)
+		}
+	}
+	if in.DependsOn != nil {
+		t, _ := todos.Get(id)
+		t.DependsOn = nil
+		for _, dep := range *in.DependsOn {
+			if err := todos.AddDependency(id, dep); err != nil {
+				return badRequest(err)
+			}
+		}
+	}
+	if in.Completed != nil {
+		t, _ := todos.Get(id)
+		if t.Completed != *in.Completed {
+			if *in.Completed && !in.force {
+				if err := todos.checkBlocked(id); err != nil {
+					return err
+				}
+			}
+			return todos.Toggle(id)
+		}
+	}
+	return nil
+}
+
+// syncList is the body of GET /sync: the whole list in its stored form.
+type syncList struct {
+	NextID int
+	Items  []Todo
+}
+
+// syncRequest is the body of POST /sync. Each change names the ETag the
+// client loaded (empty for a todo it created) and the new state of the todo
+// (nil to delete it). BaseNextID is the NextID the client loaded; creating
+// todos fails if another client has added todos since.
+type syncRequest struct {
+	BaseNextID int
+	NextID     int
+	Changes    []syncChange
+}
+
+type syncChange struct {
+	ID      int
+	IfMatch string
+	Todo    *Todo `json:",omitempty"`
+}
+
+func (s *Server) handleSyncGet(w http.ResponseWriter, r *http.Request) {
+	todos, err := s.view()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", listETag(todos))
+	writeJSON(w, http.StatusOK, syncList{NextID: todos.NextID, Items: todos.Items})
+}
+
+// handleSyncPost applies all changes or none of them.
+func (s *Server) handleSyncPost(w http.ResponseWriter, r *http.Request) {
+	var req syncRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	err := s.update("remote", func(todos *Todos) error {
+		return applySync(todos, req)
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func applySync(todos *Todos, req syncRequest) error {
+	seen := make(map[int]bool, len(req.Changes))
+	for _, c := range req.Changes {
+		if seen[c.ID] {
+			return &httpError{http.StatusBadRequest, fmt.Sprintf("more than one change for todo %d", c.ID)}
+		}
+		seen[c.ID] = true
+		existing, err := todos.Get(c.ID)
+		switch {
+		case c.Todo == nil:
+			// A delete always names the todo it removes and the ETag it saw.
+			if err != nil || todoETag(*existing) != c.IfMatch {
+				return errPreconditionFailed
+			}
+		case c.IfMatch == "":
+			if err == nil || todos.NextID != req.BaseNextID {
+				return errPreconditionFailed
+			}
+		case err != nil || todoETag(*existing) != c.IfMatch:
+			return errPreconditionFailed
+		}
+		if c.Todo != nil && c.Todo.ID != c.ID {
+			return &httpError{http.StatusBadRequest, "change id doesn't match its todo"}
+		}
+	}
+	for _, c := range req.Changes {
+		index, err := todos.indexOf(c.ID)
+		switch {
+		case c.Todo == nil && err != nil:
+			return errPreconditionFailed
+		case c.Todo == nil:
+			todos.Items = append(todos.Items[:index], todos.Items[index+1:]...)
+		case err != nil:
+			todos.Items = append(todos.Items, *c.Todo)
+		default:
+			todos.Items[index] = *c.Todo
+		}
+	}
+	todos.NextID = max(todos.NextID, req.NextID)
+	return nil
+}
+
+func pathID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return 0, &httpError{http.StatusBadRequest, fmt.Sprintf("invalid id %q", r.PathValue("id"))}
+	}
+	return id, nil
+}
+
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 10<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return &httpError{http.StatusBadRequest, "invalid request body: " + err.Error()}
+	}
+	return nil
+}
+
+func writeTodo(w http.ResponseWriter, status int, t Todo) {
+	w.Header().Set("ETag", todoETag(t))
+	writeJSON(w, status, newTodoView(t, time.Now()))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var he *httpError
+	switch {
+	case errors.As(err, &he):
+		status = he.status
+	case errors.Is(err, errNoTodo):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrBlocked):
+		status = http.StatusConflict
+	case errors.Is(err, ErrLocked):
+		status = http.StatusServiceUnavailable
+	}
+	if status == http.StatusInternalServerError {
+		log.Printf("todo serve: %v", err)
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
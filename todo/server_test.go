@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	t.Setenv("TODO_AUTO_ARCHIVE", "")
+	file := filepath.Join(t.TempDir(), "todos.json")
+	s := &Server{
+		Store:   &Storage[Todos]{FileName: file, Schema: todoSchema},
+		History: openHistory(file),
+	}
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestServerIfMatch(t *testing.T) {
+	srv := newTestServer(t)
+	var first, latest string
+	steps := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		ifMatch func() string
+		status  int
+	}{
+		{"create", "POST", "/todos", `{"title":"Buy milk"}`, nil, http.StatusCreated},
+		{"edit with the current ETag", "PATCH", "/todos/1", `{"title":"Buy oat milk"}`, func() string { return latest }, http.StatusOK},
+		{"edit with a stale ETag", "PATCH", "/todos/1", `{"title":"Buy cream"}`, func() string { return first }, http.StatusPreconditionFailed},
+		{"toggle with a stale ETag", "POST", "/todos/1/toggle", "", func() string { return first }, http.StatusPreconditionFailed},
+		{"delete with a stale ETag", "DELETE", "/todos/1", "", func() string { return first }, http.StatusPreconditionFailed},
+		{"edit with any ETag", "PATCH", "/todos/1", `{"priority":"high"}`, func() string { return "*" }, http.StatusOK},
+		{"toggle without If-Match", "POST", "/todos/1/toggle", "", nil, http.StatusOK},
+		{"get", "GET", "/todos/1", "", nil, http.StatusOK},
+		{"delete with the current ETag", "DELETE", "/todos/1", "", func() string { return latest }, http.StatusNoContent},
+		{"get a deleted todo", "GET", "/todos/1", "", nil, http.StatusNotFound},
+	}
+	for _, step := range steps {
+		req, err := http.NewRequest(step.method, srv.URL+step.path, strings.NewReader(step.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if step.ifMatch != nil {
+			req.Header.Set("If-Match", step.ifMatch())
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != step.status {
+			t.Fatalf("%s: status %d, want %d", step.name, resp.StatusCode, step.status)
+		}
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			if first == "" {
+				first = etag
+			} else if step.method != "GET" && etag == latest {
+				t.Errorf("%s: the ETag didn't change", step.name)
+			}
+			latest = etag
+		}
+	}
+}
+
+func TestServerStaleEditChangesNothing(t *testing.T) {
+	srv := newTestServer(t)
+	resp, err := http.Post(srv.URL+"/todos", "application/json", strings.NewReader(`{"title":"a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+
+	for _, title := range []string{"b", "c"} {
+		req, _ := http.NewRequest("PATCH", srv.URL+"/todos/1", strings.NewReader(`{"title":"`+title+`"}`))
+		req.Header.Set("If-Match", etag)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err = http.Get(srv.URL + "/todos/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var view TodoView
+	if err := json.NewDecoder(resp.Body).Decode(&view); err != nil {
+		t.Fatal(err)
+	}
+	if view.Title != "b" {
+		t.Errorf("title is %q; the second edit used a stale ETag and should have failed", view.Title)
+	}
+
+	// The list ETag answers conditional GETs.
+	resp, err = http.Get(srv.URL + "/todos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	req, _ := http.NewRequest("GET", srv.URL+"/todos", nil)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("conditional GET of an unchanged list: status %d, want 304", resp.StatusCode)
+	}
+}
+
+func TestServerSyncRejectsBadDeletes(t *testing.T) {
+	srv := newTestServer(t)
+	resp, err := http.Post(srv.URL+"/todos", "application/json", strings.NewReader(`{"title":"a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+
+	listETag := func() string {
+		resp, err := http.Get(srv.URL + "/sync")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("ETag")
+	}
+	before := listETag()
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"missing todo", `{"BaseNextID":2,"NextID":2,"Changes":[{"ID":7}]}`, http.StatusPreconditionFailed},
+		{"missing todo with an ETag", `{"BaseNextID":2,"NextID":2,"Changes":[{"ID":7,"IfMatch":` + strconv.Quote(etag) + `}]}`, http.StatusPreconditionFailed},
+		{"without an ETag", `{"BaseNextID":2,"NextID":2,"Changes":[{"ID":1}]}`, http.StatusPreconditionFailed},
+		{"with a stale ETag", `{"BaseNextID":2,"NextID":2,"Changes":[{"ID":1,"IfMatch":"\"stale\""}]}`, http.StatusPreconditionFailed},
+		{"twice", `{"BaseNextID":2,"NextID":2,"Changes":[{"ID":1,"IfMatch":` + strconv.Quote(etag) + `},{"ID":1,"IfMatch":` + strconv.Quote(etag) + `}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(srv.URL+"/sync", "application/json", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if after := listETag(); after != before {
+			t.Errorf("%s: the list changed", tt.name)
+		}
+	}
+}
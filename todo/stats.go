@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Stats summarises when todos were created and completed.
+type Stats struct {
+	Open, Completed int
+	// LeadTime is the average time from creation to completion;
+	// MedianLeadTime is less affected by a few long-forgotten todos.
+	LeadTime, MedianLeadTime time.Duration
+	// Streak is the number of days in a row, up to today, with at least one
+	// completion. A day without completions yet today doesn't break it.
+	Streak, LongestStreak int
+	// PerDay counts completions by day, keyed by the start of the day.
+	PerDay map[time.Time]int
+	// Oldest are the open todos that were created longest ago.
+	Oldest []Todo
+}
+
+// Stats computes the statistics of the list as of now, listing up to
+// oldest open todos.
+func (todos *Todos) Stats(now time.Time, oldest int) Stats {
+	s := Stats{PerDay: make(map[time.Time]int)}
+	var leads []time.Duration
+	var open []Todo
+	for _, t := range todos.Items {
+		if !t.Completed {
+			s.Open++
+			open = append(open, t)
+			continue
+		}
+		s.Completed++
+		if t.CompletedAt == nil {
+			continue
+		}
+		s.PerDay[startOfDay(t.CompletedAt.In(now.Location()))]++
+		leads = append(leads, t.CompletedAt.Sub(t.CreatedAt))
+	}
+
+	if len(leads) > 0 {
+		var total time.Duration
+		for _, d := range leads {
+			total += d
+		}
+		s.LeadTime = total / time.Duration(len(leads))
+		slices.Sort(leads)
+		s.MedianLeadTime = leads[len(leads)/2]
+		if len(leads)%2 == 0 {
+			s.MedianLeadTime = (leads[len(leads)/2-1] + leads[len(leads)/2]) / 2
+		}
+	}
+
+	day := startOfDay(now)
+	if s.PerDay[day] == 0 {
+		day = day.AddDate(0, 0, -1)
+	}
+	for s.PerDay[day] > 0 {
+		s.Streak++
+		day = day.AddDate(0, 0, -1)
+	}
+	days := make([]time.Time, 0, len(s.PerDay))
+	for d := range s.PerDay {
+		days = append(days, d)
+	}
+	slices.SortFunc(days, time.Time.Compare)
+	run := 0
+	for i, d := range days {
+		if i > 0 && days[i-1].AddDate(0, 0, 1).Equal(d) {
+			run++
+		} else {
+			run = 1
+		}
+		s.LongestStreak = max(s.LongestStreak, run)
+	}
+
+	slices.SortStableFunc(open, func(a, b Todo) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	s.Oldest = open[:min(oldest, len(open))]
+	return s
+}
+
+// weekStart returns the Monday starting the week of t.
+func weekStart(t time.Time) time.Time {
+	day := startOfDay(t)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// PerWeek returns the completions in each of the last n weeks, oldest
+// first, together with the Monday each week starts on.
+func (s Stats) PerWeek(now time.Time, n int) ([]time.Time, []int) {
+	starts := make([]time.Time, n)
+	counts := make([]int, n)
+	first := weekStart(now).AddDate(0, 0, -7*(n-1))
+	for i := range starts {
+		starts[i] = first.AddDate(0, 0, 7*i)
+	}
+	for day, count := range s.PerDay {
+		if day.Before(first) || day.After(now) {
+			continue
+		}
+		counts[int(weekStart(day).Sub(first).Hours()+12)/(7*24)] += count
+	}
+	return starts, counts
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws one block per value, scaled to the largest.
+func sparkline(values []int) string {
+	top := slices.Max(values)
+	var b strings.Builder
+	for _, v := range values {
+		if top == 0 {
+			b.WriteRune(sparkBlocks[0])
+			continue
+		}
+		b.WriteRune(sparkBlocks[v*(len(sparkBlocks)-1)/top])
+	}
+	return b.String()
+}
+
+var heatShades = []string{"·", "░", "▒", "▓", "█"}
+
+// heatShade picks the shade for a day's count, relative to the busiest day.
+func heatShade(count, top int) string {
+	if count == 0 || top == 0 {
+		return heatShades[0]
+	}
+	return heatShades[(count*(len(heatShades)-1)+top-1)/top]
+}
+
+// formatLeadTime shows a duration in the two largest units, such as
+// "3d 4h" or "2h 15m".
+func formatLeadTime(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days, hours, minutes := int(d.Hours())/24, int(d.Hours())%24, int(d.Minutes())%60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// printStats writes the statistics with charts covering the last weeks.
+func printStats(w io.Writer, s Stats, now time.Time, weeks int) {
+	fmt.Fprintf(w, "Completed   %d of %d (%d open)\n", s.Completed, s.Completed+s.Open, s.Open)
+	if s.LeadTime > 0 {
+		fmt.Fprintf(w, "Lead time   %s on average, %s median\n", formatLeadTime(s.LeadTime), formatLeadTime(s.MedianLeadTime))
+	}
+	fmt.Fprintf(w, "Streak      %s (longest %s)\n", plural(s.Streak, "day"), plural(s.LongestStreak, "day"))
+
+	fmt.Fprintln(w, "\nCompleted per day, last 7 days")
+	today := startOfDay(now)
+	top := 0
+	for i := range 7 {
+		top = max(top, s.PerDay[today.AddDate(0, 0, -i)])
+	}
+	for i := 6; i >= 0; i-- {
+		day := today.AddDate(0, 0, -i)
+		count := s.PerDay[day]
+		bar := ""
+		if top > 0 {
+			bar = strings.Repeat("█", (count*20+top-1)/top)
+		}
+		fmt.Fprintf(w, "  %s  %-20s %d\n", day.Format("Mon 02 Jan"), bar, count)
+	}
+
+	starts, counts := s.PerWeek(now, weeks)
+	fmt.Fprintf(w, "\nCompleted per week, last %s\n", plural(weeks, "week"))
+	fmt.Fprintf(w, "  %s  %s\n", starts[0].Format("02 Jan"), sparkline(counts))
+	fmt.Fprintf(w, "  %d this week, %d last week, %d at most\n", counts[weeks-1], counts[max(weeks-2, 0)], slices.Max(counts))
+
+	// One row per weekday and one column per week, like a contribution
+	// calendar. Days after today are left blank.
+	top = 0
+	for day, count := range s.PerDay {
+		if !day.Before(starts[0]) {
+			top = max(top, count)
+		}
+	}
+	fmt.Fprintf(w, "\nHeatmap, last %s (%s none, %s most)\n", plural(weeks, "week"), heatShades[0], heatShades[len(heatShades)-1])
+	for weekday := range 7 {
+		var b strings.Builder
+		for _, start := range starts {
+			day := start.AddDate(0, 0, weekday)
+			if day.After(today) {
+				b.WriteString(" ")
+				continue
+			}
+			b.WriteString(heatShade(s.PerDay[day], top))
+		}
+		fmt.Fprintf(w, "  %s  %s\n", starts[0].AddDate(0, 0, weekday).Format("Mon"), b.String())
+	}
+
+	if len(s.Oldest) > 0 {
+		fmt.Fprintln(w, "\nOldest open todos")
+		for _, t := range s.Oldest {
+			age := int(today.Sub(startOfDay(t.CreatedAt.In(now.Location()))).Hours()+12) / 24
+			fmt.Fprintf(w, "  %4d  %s (%s old)\n", t.ID, t.Title, plural(age, "day"))
+		}
+	}
+}
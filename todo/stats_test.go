@@ -0,0 +1,132 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStreaks(t *testing.T) {
+	// A Wednesday afternoon; the Monday before starts the week.
+	now := time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name            string
+		daysAgo         []int // one completion on each of these days
+		streak, longest int
+	}{
+		{"none", nil, 0, 0},
+		{"today", []int{0}, 1, 1},
+		{"into last week", []int{0, 1, 2, 3}, 4, 4},
+		{"nothing yet today", []int{1, 2, 3}, 3, 3},
+		{"missed yesterday", []int{0, 2, 3}, 1, 2},
+		{"missed two days", []int{2, 3, 4}, 0, 3},
+		{"longer before a gap", []int{0, 1, 3, 4, 5, 6, 7, 8}, 2, 6},
+		{"several on a day", []int{0, 0, 1, 1, 1}, 2, 2},
+	}
+	for _, tt := range tests {
+		var todos Todos
+		for i, ago := range tt.daysAgo {
+			// Just after midnight and just before it, so a day boundary
+			// off by a few minutes shows.
+			done := startOfDay(now).AddDate(0, 0, -ago).Add(5 * time.Minute)
+			if i%2 == 1 && ago > 0 {
+				done = startOfDay(now).AddDate(0, 0, 1-ago).Add(-5 * time.Minute)
+			}
+			todos.Items = append(todos.Items, Todo{ID: i + 1, Completed: true, CreatedAt: done.Add(-time.Hour), CompletedAt: &done})
+		}
+		s := todos.Stats(now, 0)
+		if s.Streak != tt.streak || s.LongestStreak != tt.longest {
+			t.Errorf("%s: streak %d and longest %d, want %d and %d", tt.name, s.Streak, s.LongestStreak, tt.streak, tt.longest)
+		}
+	}
+}
+
+func TestLeadTime(t *testing.T) {
+	created := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	now := created.AddDate(0, 0, 14)
+	tests := []struct {
+		leads           []time.Duration
+		average, median time.Duration
+	}{
+		{nil, 0, 0},
+		{[]time.Duration{time.Hour}, time.Hour, time.Hour},
+		{[]time.Duration{3 * time.Hour, time.Hour, 2 * time.Hour}, 2 * time.Hour, 2 * time.Hour},
+		{[]time.Duration{time.Hour, 10 * time.Hour, 2 * time.Hour, 3 * time.Hour}, 4 * time.Hour, 150 * time.Minute},
+	}
+	for _, tt := range tests {
+		todos := Todos{Items: []Todo{
+			{ID: 1, Title: "open", CreatedAt: created},
+			{ID: 2, Title: "completed before times were kept", Completed: true, CreatedAt: created},
+		}}
+		for i, lead := range tt.leads {
+			done := created.Add(lead)
+			todos.Items = append(todos.Items, Todo{ID: i + 3, Completed: true, CreatedAt: created, CompletedAt: &done})
+		}
+		s := todos.Stats(now, 0)
+		if s.LeadTime != tt.average || s.MedianLeadTime != tt.median {
+			t.Errorf("leads %v: average %v and median %v, want %v and %v", tt.leads, s.LeadTime, s.MedianLeadTime, tt.average, tt.median)
+		}
+		if s.Open != 1 || s.Completed != len(tt.leads)+1 {
+			t.Errorf("leads %v: %d open and %d completed", tt.leads, s.Open, s.Completed)
+		}
+	}
+}
+
+func TestOldestOpen(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 9, 0, 0, 0, time.UTC) }
+	todos := Todos{Items: []Todo{
+		{ID: 1, CreatedAt: day(5)},
+		{ID: 2, CreatedAt: day(1), Completed: true},
+		{ID: 3, CreatedAt: day(2)},
+		{ID: 4, CreatedAt: day(9)},
+		{ID: 5, CreatedAt: day(2)},
+	}}
+	for _, tt := range []struct {
+		n    int
+		want []int
+	}{{0, nil}, {2, []int{3, 5}}, {9, []int{3, 5, 1, 4}}} {
+		var ids []int
+		for _, item := range todos.Stats(day(14), tt.n).Oldest {
+			ids = append(ids, item.ID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("oldest %d: %v, want %v", tt.n, ids, tt.want)
+		}
+	}
+}
+
+func TestPerWeek(t *testing.T) {
+	day := func(month time.Month, d int) time.Time { return time.Date(2026, month, d, 0, 0, 0, 0, time.UTC) }
+	now := time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC)
+	s := Stats{PerDay: map[time.Time]int{
+		day(9, 27):  7, // the Sunday before the first week
+		day(9, 28):  1, // the Monday starting it
+		day(10, 4):  2,
+		day(10, 5):  3,
+		day(10, 11): 4,
+		day(10, 12): 5,
+		day(10, 14): 6,
+		day(10, 15): 8, // tomorrow
+	}}
+	starts, counts := s.PerWeek(now, 3)
+	if want := []time.Time{day(9, 28), day(10, 5), day(10, 12)}; !slices.EqualFunc(starts, want, time.Time.Equal) {
+		t.Errorf("weeks start %v, want %v", starts, want)
+	}
+	if want := []int{3, 7, 11}; !slices.Equal(counts, want) {
+		t.Errorf("counts %v, want %v", counts, want)
+	}
+}
+
+func TestPerWeekAcrossDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	// Clocks go back on Sunday 25 October 2026, which has 25 hours.
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, berlin) }
+	s := Stats{PerDay: map[time.Time]int{day(19): 1, day(25): 2, day(26): 4, day(28): 8}}
+	starts, counts := s.PerWeek(time.Date(2026, 10, 28, 12, 0, 0, 0, berlin), 2)
+	if !starts[1].Equal(day(26)) || !slices.Equal(counts, []int{3, 12}) {
+		t.Errorf("weeks %v with counts %v, want the second starting on the 26th and [3 12]", starts, counts)
+	}
+}
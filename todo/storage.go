@@ -1,30 +1,230 @@
 package main
 
 import (
-	"os"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 )
 
-type Storage [T any] struct {
+// ErrLocked is returned by Lock when another process holds the lock for
+// longer than the lock timeout.
+var ErrLocked = errors.New("file is locked by another process")
+
+// lockTimeout is how long Lock keeps retrying before giving up.
+const lockTimeout = 3 * time.Second
+
+type Storage[T any] struct {
 	FileName string
+	// Secret decrypts the file when it is encrypted. An encrypted file stays
+	// encrypted when saved, and a new file is encrypted when the secret is
+	// configured; Rekey switches an existing file between the two.
+	Secret *Secret
+	// Schema, when set, versions the file: see schema.go.
+	Schema *Schema
 }
 
 func NewStorage[T any](fileName string) *Storage[T] {
 	return &Storage[T]{FileName: fileName}
 }
 
+// Save writes the data to a temporary file next to FileName, syncs it and
+// renames it into place, so a crash leaves either the old or the new file
+// and never a truncated one. It refuses to replace an encrypted file it
+// can't decrypt, as that would lose whatever the file holds.
 func (s *Storage[T]) Save(data T) error {
 	fileData, err := json.MarshalIndent(data, "", "    ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.FileName, fileData, 0644)
+	if s.Schema != nil {
+		if fileData, err = s.Schema.wrap(fileData); err != nil {
+			return err
+		}
+	}
+	current, err := os.ReadFile(s.FileName)
+	switch {
+	case err == nil:
+		env, encrypted := parseEncrypted(current)
+		plain := current
+		if encrypted {
+			if plain, err = s.Secret.open(env); err != nil {
+				return fmt.Errorf("refusing to overwrite %s: %w", s.FileName, err)
+			}
+		}
+		if s.Schema != nil {
+			if err := s.Schema.checkOverwrite(s.FileName, current, plain); err != nil {
+				return err
+			}
+		}
+		if encrypted {
+			if fileData, err = s.Secret.seal(fileData, env); err != nil {
+				return err
+			}
+		}
+	case errors.Is(err, os.ErrNotExist):
+		if s.Secret.configured() {
+			if fileData, err = s.Secret.seal(fileData, nil); err != nil {
+				return err
+			}
+		}
+	default:
+		return err
+	}
+	return writeFileAtomic(s.FileName, fileData, 0644)
 }
 
+// Load reads the file, upgrading it in memory if it was written by an older
+// version of todo. The file itself is upgraded on the next Save.
 func (s *Storage[T]) Load(data *T) error {
+	fileData, err := s.read()
+	if err != nil {
+		return err
+	}
+	if s.Schema != nil {
+		var version int
+		fileData, version = s.Schema.unwrap(fileData)
+		if version < s.Schema.Version {
+			if fileData, err = s.Schema.migrate(fileData, version); err != nil {
+				return fmt.Errorf("%s: %w", s.FileName, err)
+			}
+		}
+	}
+	return json.Unmarshal(fileData, data)
+}
+
+// read returns the file's contents, decrypted if need be.
+func (s *Storage[T]) read() ([]byte, error) {
 	fileData, err := os.ReadFile(s.FileName)
+	if err != nil {
+		return nil, err
+	}
+	if env, ok := parseEncrypted(fileData); ok {
+		if fileData, err = s.Secret.open(env); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.FileName, err)
+		}
+	}
+	return fileData, nil
+}
+
+// CheckWritable fails when Save would refuse to overwrite the file because
+// a newer version of todo wrote it, so commands can stop before changing
+// anything.
+func (s *Storage[T]) CheckWritable() error {
+	if s.Schema == nil {
+		return nil
+	}
+	fileData, err := s.read()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.Schema.checkNewer(s.FileName, fileData)
+}
+
+// Rekey rewrites the file encrypted with a new secret, or as plain JSON when
+// to is nil, leaving its contents as they are. Storage then uses the new
+// secret.
+func (s *Storage[T]) Rekey(to *Secret) error {
+	fileData, err := s.read()
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(fileData,data)
+	if to != nil {
+		if fileData, err = to.seal(fileData, nil); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(s.FileName, fileData, 0644); err != nil {
+		return err
+	}
+	s.Secret = to
+	return nil
+}
+
+// Lock takes an advisory lock on FileName. Hold it around a whole
+// load-modify-save cycle so concurrent processes don't lose each other's
+// changes. The returned function releases the lock.
+func (s *Storage[T]) Lock() (func() error, error) {
+	return lockFile(s.FileName)
+}
+
+// lockFile locks name through a separate ".lock" file, as data files may be
+// replaced on save.
+func lockFile(name string) (func() error, error) {
+	lockName := name + ".lock"
+	f, err := os.OpenFile(lockName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err = tryLockFile(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrLocked) || time.Now().After(deadline) {
+			f.Close()
+			if errors.Is(err, ErrLocked) {
+				return nil, fmt.Errorf("%s: %w; try again once it has finished", name, ErrLocked)
+			}
+			return nil, fmt.Errorf("locking %s: %w", lockName, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return func() error {
+		if err := unlockFile(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}, nil
+}
+
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(name)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Clean up the temp file on any failure; after the rename it's gone.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes a directory so a rename inside it survives a crash. This is
+// best effort: some platforms can't open or sync directories.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil
+	}
+	defer d.Close()
+	d.Sync()
+	return nil
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "todos.json")
+	if err := writeFileAtomic(file, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(file, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(file)
+	info, _ := os.Stat(file)
+	if string(data) != "new" || info.Mode().Perm() != 0644 {
+		t.Errorf("file holds %q with mode %v, want %q with 0644", data, info.Mode().Perm(), "new")
+	}
+
+	// A write that can't be renamed into place leaves what was there.
+	target := filepath.Join(dir, "busy")
+	os.MkdirAll(filepath.Join(target, "child"), 0755)
+	if err := writeFileAtomic(target, []byte("new"), 0644); err == nil {
+		t.Error("replaced a directory")
+	}
+	if _, err := os.Stat(filepath.Join(target, "child")); err != nil {
+		t.Errorf("the directory changed: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("left %v behind, want only todos.json and busy", names)
+	}
+}
+
+func TestSaveFailureKeepsFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data.json")
+	store := NewStorage[any](file)
+	if err := store.Save(map[string]int{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(file)
+	if err := store.Save(make(chan int)); err == nil {
+		t.Fatal("saved a value that can't be encoded")
+	}
+	if after, _ := os.ReadFile(file); string(after) != string(before) {
+		t.Errorf("a failed save changed the file to %q", after)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Store is the persistence contract the todo commands rely on. Storage[T]
+// implements it with a single JSON file; other backends live in store_*.go.
+type Store[T any] interface {
+	// Load reads the stored data into data. A store that doesn't exist yet
+	// returns an error matching os.ErrNotExist.
+	Load(data *T) error
+	// Save replaces the stored data with data.
+	Save(data T) error
+	// Lock takes an exclusive advisory lock for a load-modify-save cycle and
+	// returns the function that releases it.
+	Lock() (func() error, error)
+}
+
+// Backend names accepted by -store and TODO_STORE.
+var backends = []string{"json", "jsonl", "sqlite"}
+
+// backendExt is the file extension each backend's data files use.
+func backendExt(backend string) string {
+	switch backend {
+	case "jsonl":
+		return ".jsonl"
+	case "sqlite":
+		return ".db"
+	}
+	return ".json"
+}
+
+// normalizeBackend checks a backend name, defaulting to json.
+func normalizeBackend(backend string) (string, error) {
+	backend = strings.ToLower(strings.TrimSpace(backend))
+	if backend == "" {
+		return "json", nil
+	}
+	if !slices.Contains(backends, backend) {
+		return "", fmt.Errorf("unknown store %q (use %s)", backend, strings.Join(backends, ", "))
+	}
+	return backend, nil
+}
+
+// historyFileName is where the undo history of a store is kept.
+func historyFileName(fileName string) string {
+	return fileName + ".history"
+}
+
+// openHistory returns the undo history of the store in fileName. It is
+// encrypted along with the list, as it holds copies of the todos.
+func openHistory(fileName string) *Storage[History] {
+	return &Storage[History]{FileName: historyFileName(fileName), Secret: secret}
+}
+
+// remindersFileName is where `todo remind` records what it sent.
+func remindersFileName(fileName string) string {
+	return fileName + ".reminders"
+}
+
+// openStore returns the store for the named backend, reading from fileName.
+func openStore(backend, fileName string) (Store[Todos], error) {
+	backend, err := normalizeBackend(backend)
+	if err != nil {
+		return nil, err
+	}
+	switch backend {
+	case "jsonl":
+		return NewJSONLStore(fileName), nil
+	case "sqlite":
+		return NewSQLiteStore(fileName), nil
+	}
+	return &Storage[Todos]{FileName: fileName, Secret: secret, Schema: todoSchema}, nil
+}
+
+// todoSnapshot remembers how each todo looked when it was loaded, so the
+// incremental backends only write the todos that changed.
+type todoSnapshot struct {
+	NextID int
+	Data   map[int]string
+}
+
+func newTodoSnapshot() todoSnapshot {
+	return todoSnapshot{Data: make(map[int]string)}
+}
+
+func encodeTodo(t Todo) (string, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
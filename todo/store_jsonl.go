@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// jsonlRecord is one line of a JSON-lines store. A "put" adds or replaces a
+// todo, a "delete" removes one and "next" records the next ID to hand out.
+type jsonlRecord struct {
+	Op     string
+	Todo   *Todo `json:",omitempty"`
+	ID     int   `json:",omitempty"`
+	NextID int   `json:",omitempty"`
+}
+
+// JSONLStore is an append-only log of changes. Saving appends a record per
+// changed todo instead of rewriting the file; once the log is mostly stale
+// records it is compacted into a fresh file.
+type JSONLStore struct {
+	FileName string
+
+	loaded   bool
+	snapshot todoSnapshot
+	order    []int
+	records  int
+	size     int64 // length of the file up to the last complete record
+}
+
+func NewJSONLStore(fileName string) *JSONLStore {
+	return &JSONLStore{FileName: fileName, snapshot: newTodoSnapshot()}
+}
+
+func (s *JSONLStore) Load(data *Todos) error {
+	fileData, err := os.ReadFile(s.FileName)
+	if err != nil {
+		return err
+	}
+
+	todos := Todos{}
+	snapshot := newTodoSnapshot()
+	index := make(map[int]int)
+	records := 0
+	var size int64
+
+	for len(fileData) > 0 {
+		line, rest, complete := bytes.Cut(fileData, []byte("\n"))
+		if !complete {
+			// A crash in the middle of an append leaves a partial last line;
+			// it never made it into a save, so drop it.
+			break
+		}
+		fileData = rest
+		size += int64(len(line)) + 1
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var rec jsonlRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("%s: record %d: %w", s.FileName, records+1, err)
+		}
+		records++
+
+		switch rec.Op {
+		case "put":
+			if rec.Todo == nil {
+				return fmt.Errorf("%s: record %d: put without a todo", s.FileName, records)
+			}
+			if i, ok := index[rec.Todo.ID]; ok {
+				todos.Items[i] = *rec.Todo
+			} else {
+				index[rec.Todo.ID] = len(todos.Items)
+				todos.Items = append(todos.Items, *rec.Todo)
+			}
+		case "delete":
+			if i, ok := index[rec.ID]; ok {
+				todos.Items = slices.Delete(todos.Items, i, i+1)
+				delete(index, rec.ID)
+				for id, j := range index {
+					if j > i {
+						index[id] = j - 1
+					}
+				}
+			}
+		case "next":
+			todos.NextID = rec.NextID
+		default:
+			return fmt.Errorf("%s: record %d: unknown op %q", s.FileName, records, rec.Op)
+		}
+	}
+	todos.ensureIDs()
+
+	order := make([]int, 0, len(todos.Items))
+	for _, t := range todos.Items {
+		raw, err := encodeTodo(t)
+		if err != nil {
+			return err
+		}
+		snapshot.Data[t.ID] = raw
+		order = append(order, t.ID)
+	}
+	snapshot.NextID = todos.NextID
+
+	*data = todos
+	s.loaded = true
+	s.snapshot = snapshot
+	s.order = order
+	s.records = records
+	s.size = size
+	return nil
+}
+
+// Save appends records for the todos that changed since Load. If todos were
+// reordered, the store was never loaded, or the log has grown well past the
+// number of live todos, the file is rewritten instead.
+func (s *JSONLStore) Save(data Todos) error {
+	var recs []jsonlRecord
+	snapshot := newTodoSnapshot()
+	order := make([]int, 0, len(data.Items))
+	for i := range data.Items {
+		t := data.Items[i]
+		raw, err := encodeTodo(t)
+		if err != nil {
+			return err
+		}
+		if raw != s.snapshot.Data[t.ID] {
+			recs = append(recs, jsonlRecord{Op: "put", Todo: &data.Items[i]})
+		}
+		snapshot.Data[t.ID] = raw
+		order = append(order, t.ID)
+	}
+	for _, id := range s.order {
+		if _, ok := snapshot.Data[id]; !ok {
+			recs = append(recs, jsonlRecord{Op: "delete", ID: id})
+		}
+	}
+	if data.NextID != s.snapshot.NextID {
+		recs = append(recs, jsonlRecord{Op: "next", NextID: data.NextID})
+	}
+	snapshot.NextID = data.NextID
+
+	var err error
+	if !s.loaded || !s.appendKeepsOrder(order) || s.records+len(recs) > 2*len(data.Items)+100 {
+		err = s.rewrite(data)
+	} else {
+		err = s.append(recs)
+	}
+	if err != nil {
+		return err
+	}
+	s.loaded = true
+	s.snapshot = snapshot
+	s.order = order
+	return nil
+}
+
+// appendKeepsOrder reports whether replaying appended records would produce
+// the given order: surviving todos must keep their relative order and new
+// ones can only go at the end.
+func (s *JSONLStore) appendKeepsOrder(order []int) bool {
+	present := make(map[int]bool, len(order))
+	for _, id := range order {
+		present[id] = true
+	}
+	var kept []int
+	for _, id := range s.order {
+		if present[id] {
+			kept = append(kept, id)
+		}
+	}
+	return len(order) >= len(kept) && slices.Equal(order[:len(kept)], kept)
+}
+
+func (s *JSONLStore) append(recs []jsonlRecord) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rec := range recs {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(s.FileName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	// Drop any partial record left behind by an earlier crash.
+	if err := f.Truncate(s.size); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.WriteAt(buf.Bytes(), s.size); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.size += int64(buf.Len())
+	s.records += len(recs)
+	return nil
+}
+
+// rewrite replaces the log with one put per todo.
+func (s *JSONLStore) rewrite(data Todos) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(jsonlRecord{Op: "next", NextID: data.NextID}); err != nil {
+		return err
+	}
+	for i := range data.Items {
+		if err := enc.Encode(jsonlRecord{Op: "put", Todo: &data.Items[i]}); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(s.FileName, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	s.size = int64(buf.Len())
+	s.records = len(data.Items) + 1
+	return nil
+}
+
+func (s *JSONLStore) Lock() (func() error, error) {
+	return lockFile(s.FileName)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS todos (
+	id       INTEGER PRIMARY KEY,
+	position INTEGER NOT NULL,
+	data     TEXT NOT NULL
+);`
+
+// SQLiteStore keeps one row per todo, so saving after a toggle or edit only
+// rewrites the rows that changed.
+type SQLiteStore struct {
+	FileName string
+
+	loaded    bool
+	snapshot  todoSnapshot
+	positions map[int]int
+}
+
+func NewSQLiteStore(fileName string) *SQLiteStore {
+	return &SQLiteStore{FileName: fileName, snapshot: newTodoSnapshot(), positions: make(map[int]int)}
+}
+
+func (s *SQLiteStore) open() (*sql.DB, error) {
+	db, err := sql.Open("sqlite", s.FileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", s.FileName, err)
+	}
+	return db, nil
+}
+
+func (s *SQLiteStore) Load(data *Todos) error {
+	// sql.Open would create an empty database; report a missing file the
+	// same way the JSON store does instead.
+	if _, err := os.Stat(s.FileName); err != nil {
+		return err
+	}
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	todos := Todos{}
+	var nextID string
+	err = db.QueryRow(`SELECT value FROM meta WHERE key = 'next_id'`).Scan(&nextID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if nextID != "" {
+		if todos.NextID, err = strconv.Atoi(nextID); err != nil {
+			return fmt.Errorf("%s: invalid next_id %q", s.FileName, nextID)
+		}
+	}
+
+	rows, err := db.Query(`SELECT id, position, data FROM todos ORDER BY position, id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	snapshot := newTodoSnapshot()
+	positions := make(map[int]int)
+	for rows.Next() {
+		var id, position int
+		var raw string
+		if err := rows.Scan(&id, &position, &raw); err != nil {
+			return err
+		}
+		var t Todo
+		if err := json.Unmarshal([]byte(raw), &t); err != nil {
+			return fmt.Errorf("%s: todo %d: %w", s.FileName, id, err)
+		}
+		t.ID = id
+		todos.Items = append(todos.Items, t)
+		snapshot.Data[id] = raw
+		positions[id] = position
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	todos.ensureIDs()
+	snapshot.NextID = todos.NextID
+
+	*data = todos
+	s.loaded = true
+	s.snapshot = snapshot
+	s.positions = positions
+	return nil
+}
+
+// Save writes the todos that were added, changed or moved since Load and
+// deletes the ones that are gone, all in one transaction.
+func (s *SQLiteStore) Save(data Todos) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Without a Load we don't know what's stored, so replace everything.
+	if !s.loaded {
+		if _, err := tx.Exec(`DELETE FROM todos`); err != nil {
+			return err
+		}
+		s.snapshot = newTodoSnapshot()
+		s.positions = make(map[int]int)
+	}
+
+	snapshot := newTodoSnapshot()
+	positions := make(map[int]int)
+	last := -1
+	for _, t := range data.Items {
+		raw, err := encodeTodo(t)
+		if err != nil {
+			return err
+		}
+		// Keep a todo's position while the order is unchanged, so deleting
+		// one todo doesn't renumber every row after it.
+		position, known := s.positions[t.ID]
+		if !known || position <= last {
+			position = last + 1
+		}
+		last = position
+
+		if raw != s.snapshot.Data[t.ID] || position != s.positions[t.ID] || !known {
+			_, err := tx.Exec(`INSERT INTO todos (id, position, data) VALUES (?, ?, ?)
+				ON CONFLICT(id) DO UPDATE SET position = excluded.position, data = excluded.data`,
+				t.ID, position, raw)
+			if err != nil {
+				return err
+			}
+		}
+		snapshot.Data[t.ID] = raw
+		positions[t.ID] = position
+	}
+
+	for id := range s.snapshot.Data {
+		if _, ok := snapshot.Data[id]; !ok {
+			if _, err := tx.Exec(`DELETE FROM todos WHERE id = ?`, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	if data.NextID != s.snapshot.NextID || !s.loaded {
+		_, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('next_id', ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value`, strconv.Itoa(data.NextID))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	snapshot.NextID = data.NextID
+	s.loaded = true
+	s.snapshot = snapshot
+	s.positions = positions
+	return nil
+}
+
+func (s *SQLiteStore) Lock() (func() error, error) {
+	return lockFile(s.FileName)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// sampleTodos returns a list using every field a store has to keep.
+func sampleTodos() Todos {
+	var todos Todos
+	due := time.Date(2026, 11, 3, 17, 0, 0, 0, time.UTC)
+	release := todos.Add("Release 1.2")
+	todos.SetAutoComplete(release, true)
+	notes := todos.Add("Write release notes")
+	todos.SetParent(notes, release)
+	todos.SetDue(notes, &due)
+	todos.SetPriority(notes, PriorityHigh)
+	todos.AddTags(notes, "work", "docs")
+	rent := todos.Add("Pay rent")
+	todos.SetRepeat(rent, &Recurrence{Freq: "monthly", Every: 1, MonthDay: 31})
+	tag := todos.Add("Tag the release")
+	todos.AddDependency(tag, notes)
+	todos.Toggle(rent)
+	return todos
+}
+
+func sameTodos(t *testing.T, got, want Todos) {
+	t.Helper()
+	g, _ := json.Marshal(got)
+	w, _ := json.Marshal(want)
+	if string(g) != string(w) {
+		t.Errorf("loaded list differs from the saved one\n got: %s\nwant: %s", g, w)
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "todos"+backendExt(backend))
+			store, err := openStore(backend, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded Todos
+			if err := store.Load(&loaded); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("loading a missing store: got %v, want os.ErrNotExist", err)
+			}
+
+			todos := sampleTodos()
+			if err := store.Save(todos); err != nil {
+				t.Fatal(err)
+			}
+			reopened, _ := openStore(backend, file)
+			loaded = Todos{}
+			if err := reopened.Load(&loaded); err != nil {
+				t.Fatal(err)
+			}
+			sameTodos(t, loaded, todos)
+
+			// Change the loaded list and save it through the same store, the
+			// way commands do, so the incremental backends write a delta.
+			loaded.Edit(1, "Release 1.3")
+			loaded.Delete(4)
+			loaded.Move(3, -1)
+			loaded.Add("Announce it")
+			if err := reopened.Save(loaded); err != nil {
+				t.Fatal(err)
+			}
+			again, _ := openStore(backend, file)
+			var final Todos
+			if err := again.Load(&final); err != nil {
+				t.Fatal(err)
+			}
+			sameTodos(t, final, loaded)
+			if final.NextID != 7 {
+				t.Errorf("NextID = %d after reloading, want 7", final.NextID)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Subtasks are ordinary todos whose ParentID points at another todo, so they
+// keep their own ID, completion state and fields and work with every command.
+
+// SetParent makes id a subtask of parent; a parent of 0 makes it a top-level
+// todo again. A todo can't become a subtask of itself or of its own subtasks.
+func (todos *Todos) SetParent(id, parent int) error {
+	t, err := todos.Get(id)
+	if err != nil {
+		return err
+	}
+	if parent != 0 {
+		if _, err := todos.Get(parent); err != nil {
+			return err
+		}
+		if parent == id || slices.Contains(todos.descendants(id), parent) {
+			return fmt.Errorf("todo %d can't be a subtask of %d: that would make a loop", id, parent)
+		}
+	}
+	t.ParentID = parent
+	return nil
+}
+
+// SetAutoComplete sets whether a todo completes itself once all of its
+// subtasks are completed.
+func (todos *Todos) SetAutoComplete(id int, auto bool) error {
+	t, err := todos.Get(id)
+	if err != nil {
+		return err
+	}
+	t.AutoComplete = auto
+	return nil
+}
+
+// Children returns the IDs of the direct subtasks of a todo, in list order.
+func (todos *Todos) Children(id int) []int {
+	var ids []int
+	for _, t := range todos.Items {
+		if t.ParentID == id && id != 0 {
+			ids = append(ids, t.ID)
+		}
+	}
+	return ids
+}
+
+// descendants returns the IDs of every subtask below a todo.
+func (todos *Todos) descendants(id int) []int {
+	var ids []int
+	for _, child := range todos.Children(id) {
+		ids = append(ids, child)
+		ids = append(ids, todos.descendants(child)...)
+	}
+	return ids
+}
+
+// Progress returns how many of a todo's direct subtasks are completed.
+func (todos *Todos) Progress(id int) (done, total int) {
+	for _, t := range todos.Items {
+		if t.ParentID == id && id != 0 {
+			total++
+			if t.Completed {
+				done++
+			}
+		}
+	}
+	return done, total
+}
+
+// syncParent completes an auto-completing parent once all of its subtasks
+// are done, and reopens it when one of them is reopened.
+func (todos *Todos) syncParent(parentID int) error {
+	if parentID == 0 {
+		return nil
+	}
+	parent, err := todos.Get(parentID)
+	if errors.Is(err, errNoTodo) {
+		return nil
+	}
+	if err != nil || !parent.AutoComplete {
+		return err
+	}
+	done, total := todos.Progress(parentID)
+	if allDone := done == total; total > 0 && allDone != parent.Completed {
+		return todos.Toggle(parentID)
+	}
+	return nil
+}
+
+// treeRow is one line of a todo list rendered as a tree.
+type treeRow struct {
+	Todo  Todo
+	Depth int
+}
+
+// Tree returns the todos with every subtask placed under its parent. Todos
+// whose parent isn't in the list (for example because a filter dropped it)
+// are shown at the top level.
+func (todos *Todos) Tree() []treeRow {
+	present := make(map[int]bool, len(todos.Items))
+	for _, t := range todos.Items {
+		present[t.ID] = true
+	}
+	children := make(map[int][]Todo)
+	var roots []Todo
+	for _, t := range todos.Items {
+		if t.ParentID != 0 && present[t.ParentID] {
+			children[t.ParentID] = append(children[t.ParentID], t)
+		} else {
+			roots = append(roots, t)
+		}
+	}
+
+	var rows []treeRow
+	var walk func(t Todo, depth int)
+	walk = func(t Todo, depth int) {
+		rows = append(rows, treeRow{Todo: t, Depth: depth})
+		for _, child := range children[t.ID] {
+			walk(child, depth+1)
+		}
+	}
+	for _, t := range roots {
+		walk(t, 0)
+	}
+	return rows
+}
+
+// indentTitle prefixes a subtask's title so the tree shape shows in a table.
+func indentTitle(title string, depth int) string {
+	if depth == 0 {
+		return title
+	}
+	// The table trims leading whitespace, so deeper levels use guide lines.
+	return strings.Repeat("│  ", depth-1) + "└─ " + title
+}
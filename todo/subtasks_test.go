@@ -0,0 +1,137 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// subtaskSample is a release with two subtasks, one of which has its own.
+func subtaskSample() Todos {
+	var todos Todos
+	release := todos.Add("Release")  // 1
+	notes := todos.Add("Notes")      // 2
+	todos.Add("Unrelated")           // 3
+	draft := todos.Add("Draft")      // 4
+	tag := todos.Add("Tag the repo") // 5
+	todos.SetParent(notes, release)
+	todos.SetParent(draft, notes)
+	todos.SetParent(tag, release)
+	return todos
+}
+
+func TestSetParent(t *testing.T) {
+	tests := []struct {
+		name       string
+		id, parent int
+		wantErr    string // "" when the parent is set
+	}{
+		{"new parent", 3, 1, ""},
+		{"top level again", 2, 0, ""},
+		{"move a subtree", 2, 3, ""},
+		{"itself", 1, 1, "loop"},
+		{"its own subtask", 1, 2, "loop"},
+		{"deeper subtask", 1, 4, "loop"},
+		{"missing parent", 3, 9, "no todo"},
+		{"missing todo", 9, 1, "no todo"},
+	}
+	for _, tt := range tests {
+		todos := subtaskSample()
+		before, _ := todos.Get(tt.id)
+		var oldParent int
+		if before != nil {
+			oldParent = before.ParentID
+		}
+		err := todos.SetParent(tt.id, tt.parent)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: got error %v, want one mentioning %q", tt.name, err, tt.wantErr)
+		}
+		want := tt.parent
+		if tt.wantErr != "" {
+			want = oldParent
+		}
+		if got, err := todos.Get(tt.id); err == nil && got.ParentID != want {
+			t.Errorf("%s: parent %d, want %d", tt.name, got.ParentID, want)
+		}
+	}
+}
+
+func TestAutoComplete(t *testing.T) {
+	todos := subtaskSample()
+	todos.SetAutoComplete(1, true)
+	todos.SetAutoComplete(2, true)
+	completed := func(id int) bool {
+		t, _ := todos.Get(id)
+		return t.Completed
+	}
+
+	steps := []struct {
+		name        string
+		toggle      int
+		release     bool
+		notes       bool
+		done, total int // progress of the release
+	}{
+		{"one subtask done", 5, false, false, 1, 2},
+		{"last subtask of notes done", 4, true, true, 2, 2},
+		{"reopened deep down", 4, false, false, 1, 2},
+		{"done again", 4, true, true, 2, 2},
+	}
+	for _, step := range steps {
+		if err := todos.Toggle(step.toggle); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if completed(1) != step.release || completed(2) != step.notes {
+			t.Errorf("%s: release completed %v and notes %v, want %v and %v", step.name, completed(1), completed(2), step.release, step.notes)
+		}
+		if done, total := todos.Progress(1); done != step.done || total != step.total {
+			t.Errorf("%s: progress %d/%d, want %d/%d", step.name, done, total, step.done, step.total)
+		}
+	}
+
+	// Without auto-complete a parent waits for its own toggle.
+	todos = subtaskSample()
+	todos.Toggle(4)
+	if completed(2) {
+		t.Error("a parent without auto-complete was completed by its subtask")
+	}
+
+	// Deleting the last open subtask completes the parent too.
+	todos = subtaskSample()
+	todos.SetAutoComplete(1, true)
+	todos.Toggle(5)
+	if err := todos.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	if !completed(1) {
+		t.Error("deleting the last open subtask didn't complete the parent")
+	}
+	if _, err := todos.Get(4); err == nil {
+		t.Error("deleting a todo kept its subtasks")
+	}
+}
+
+func TestTree(t *testing.T) {
+	todos := subtaskSample()
+	var got []string
+	for _, row := range todos.Tree() {
+		got = append(got, strings.Repeat("  ", row.Depth)+row.Todo.Title)
+	}
+	want := []string{"Release", "  Notes", "    Draft", "  Tag the repo", "Unrelated"}
+	if !slices.Equal(got, want) {
+		t.Errorf("tree\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Subtasks whose parent was filtered out show at the top level.
+	filtered, _ := todos.Query(Query{Search: "a"})
+	got = nil
+	for _, row := range filtered.Tree() {
+		got = append(got, strings.Repeat("  ", row.Depth)+row.Todo.Title)
+	}
+	if want := []string{"Release", "  Tag the repo", "Unrelated", "Draft"}; !slices.Equal(got, want) {
+		t.Errorf("filtered tree %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// `todo sync` keeps a list in a git repository as one small JSON file per
+// todo, named after the todo's UID, under todos/<list>/. Every field sits on
+// its own line in a fixed order, so git merges edits to different todos, or
+// to different fields of one todo, without help. The IDs people type are
+// local to each machine: parents and next occurrences are stored by UID, and
+// a todo's ID is only kept as a hint for the machines that pull it.
+
+// newUID returns a random identifier for a todo that is unique across
+// machines.
+func newUID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ensureUIDs gives every todo that lacks one a UID.
+func (todos *Todos) ensureUIDs() {
+	for i := range todos.Items {
+		if todos.Items[i].UID == "" {
+			todos.Items[i].UID = newUID()
+		}
+	}
+}
+
+// syncFields are the fields of a synced todo; the local ID fields are
+// replaced by UIDs.
+type syncFields map[string]json.RawMessage
+
+// encodeSyncItem turns a todo into its file in the sync repository.
+func encodeSyncItem(t Todo, uids map[int]string) ([]byte, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	var fields syncFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "ParentID")
+	delete(fields, "NextOccurrence")
+	delete(fields, "UID") // the file name
+	if uid := uids[t.ParentID]; uid != "" {
+		fields["ParentUID"], _ = json.Marshal(uid)
+	}
+	if uid := uids[t.NextOccurrence]; uid != "" {
+		fields["NextUID"], _ = json.Marshal(uid)
+	}
+	delete(fields, "DependsOn")
+	var deps []string
+	for _, id := range t.DependsOn {
+		if uid := uids[id]; uid != "" {
+			deps = append(deps, uid)
+		}
+	}
+	if deps != nil {
+		fields["DependsOnUIDs"], _ = json.Marshal(deps)
+	}
+	return fields.encode()
+}
+
+// encode writes the fields sorted, one per line.
+func (f syncFields) encode() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for i, key := range keys {
+		var value bytes.Buffer
+		if err := json.Compact(&value, f[key]); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "  %q: %s", key, value.Bytes())
+		if i < len(keys)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	return b.Bytes(), nil
+}
+
+func parseSyncFields(data []byte) (syncFields, error) {
+	var fields syncFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// mergeSyncFields merges two edits of a todo field by field against their
+// common base. When both sides changed a field differently the local value
+// wins, and the field is reported. The ID hint never counts as a conflict.
+func mergeSyncFields(base, ours, theirs syncFields) (syncFields, []string) {
+	merged := make(syncFields)
+	var conflicts []string
+	keys := make(map[string]bool)
+	for _, f := range []syncFields{base, ours, theirs} {
+		for key := range f {
+			keys[key] = true
+		}
+	}
+	same := func(a, b json.RawMessage) bool { return bytes.Equal(a, b) }
+	for key := range keys {
+		b, o, t := base[key], ours[key], theirs[key]
+		value := o
+		switch {
+		case same(o, t), same(t, b):
+		case same(o, b):
+			value = t
+		default:
+			if key != "ID" {
+				conflicts = append(conflicts, key)
+			}
+		}
+		if value != nil {
+			merged[key] = value
+		}
+	}
+	slices.Sort(conflicts)
+	return merged, conflicts
+}
+
+// gitRepo runs git commands in a repository.
+type gitRepo struct {
+	Dir string
+	env []string
+}
+
+func (g *gitRepo) run(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.Dir
+	cmd.Env = append(os.Environ(), g.env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		name := args[0]
+		if name == "-c" && len(args) > 2 {
+			name = args[2]
+		}
+		return stdout.String(), fmt.Errorf("git %s: %v: %s", name, err, msg)
+	}
+	return stdout.String(), nil
+}
+
+// openGitRepo opens the sync repository, creating it if needed, and makes
+// sure commits have an author.
+func openGitRepo(dir string) (*gitRepo, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, errors.New("sync needs git")
+	}
+	g := &gitRepo{Dir: dir}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		if _, err := g.run("init", "--quiet"); err != nil {
+			return nil, err
+		}
+	}
+	if email, _ := g.run("config", "user.email"); strings.TrimSpace(email) == "" {
+		host, _ := os.Hostname()
+		g.env = append(g.env,
+			"GIT_AUTHOR_NAME=todo", "GIT_COMMITTER_NAME=todo",
+			"GIT_AUTHOR_EMAIL=todo@"+host, "GIT_COMMITTER_EMAIL=todo@"+host)
+	}
+	return g, nil
+}
+
+// GitSyncResult says what a sync did.
+type GitSyncResult struct {
+	Committed, NoRemote     bool
+	Added, Changed, Removed int
+	Merged                  []string // notes about concurrent edits that were merged
+}
+
+// gitSync commits the list to the repository, merges what the remote has
+// and applies the result to todos.
+func gitSync(g *gitRepo, list string, todos *Todos, origin string) (GitSyncResult, error) {
+	var result GitSyncResult
+	dir := path.Join("todos", list)
+	if err := configureOrigin(g, origin); err != nil {
+		return result, err
+	}
+
+	todos.ensureUIDs()
+	if err := writeSyncDir(filepath.Join(g.Dir, filepath.FromSlash(dir)), todos); err != nil {
+		return result, err
+	}
+	if _, err := g.run("add", "--all", "--", dir); err != nil {
+		return result, err
+	}
+	if _, err := g.run("diff", "--cached", "--quiet", "--", dir); err != nil {
+		host, _ := os.Hostname()
+		if _, err := g.run("commit", "--quiet", "-m", fmt.Sprintf("todo: update %s from %s", list, host), "--", dir); err != nil {
+			return result, err
+		}
+		result.Committed = true
+	}
+
+	remotes, err := g.run("remote")
+	if err != nil {
+		return result, err
+	}
+	if !slices.Contains(strings.Fields(remotes), "origin") {
+		result.NoRemote = true
+		return result, nil
+	}
+	branch, err := g.run("symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return result, err
+	}
+	branch = strings.TrimSpace(branch)
+
+	if _, err := g.run("fetch", "--quiet", "origin"); err != nil {
+		return result, err
+	}
+	if _, err := g.run("rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+branch); err == nil {
+		// Without rename detection, a deleted todo file and an added one
+		// similar to it are never mistaken for the same todo. The ort
+		// strategy of older git ignores no-renames, so ask for recursive.
+		if _, err := g.run("-c", "merge.renames=false", "merge", "-s", "recursive", "-X", "no-renames", "--no-edit", "--allow-unrelated-histories", "origin/"+branch); err != nil {
+			if result.Merged, err = resolveSyncConflicts(g); err != nil {
+				g.run("merge", "--abort")
+				return result, err
+			}
+		}
+	}
+
+	items, err := readSyncDir(filepath.Join(g.Dir, filepath.FromSlash(dir)))
+	if err != nil {
+		return result, err
+	}
+	result.Added, result.Changed, result.Removed = applySyncItems(todos, items)
+
+	if _, err := g.run("rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		return result, nil // nothing committed on either side yet
+	}
+	if _, err := g.run("push", "--quiet", "origin", "HEAD:refs/heads/"+branch); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// configureOrigin points the origin remote at url, when one is given.
+func configureOrigin(g *gitRepo, url string) error {
+	if url == "" {
+		return nil
+	}
+	if _, err := g.run("remote", "get-url", "origin"); err != nil {
+		_, err = g.run("remote", "add", "origin", url)
+		return err
+	}
+	_, err := g.run("remote", "set-url", "origin", url)
+	return err
+}
+
+// writeSyncDir makes dir hold exactly one file per todo.
+func writeSyncDir(dir string, todos *Todos) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	uids := make(map[int]string, len(todos.Items))
+	for _, t := range todos.Items {
+		uids[t.ID] = t.UID
+	}
+	keep := make(map[string]bool)
+	for _, t := range todos.Items {
+		data, err := encodeSyncItem(t, uids)
+		if err != nil {
+			return err
+		}
+		name := t.UID + ".json"
+		keep[name] = true
+		if current, err := os.ReadFile(filepath.Join(dir, name)); err == nil && bytes.Equal(current, data) {
+			continue
+		}
+		if err := writeFileAtomic(filepath.Join(dir, name), data, 0600); err != nil {
+			return err
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".json") && !keep[e.Name()] {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readSyncDir(dir string) (map[string]syncFields, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]syncFields)
+	for _, e := range entries {
+		uid, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		fields, err := parseSyncFields(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		items[uid] = fields
+	}
+	return items, nil
+}
+
+// resolveSyncConflicts settles the conflicts git left in todo files: edits
+// to the same todo are merged field by field, and an edit wins over a
+// delete so nothing is lost. Any other conflict is left to the user.
+func resolveSyncConflicts(g *gitRepo) ([]string, error) {
+	out, err := g.run("-c", "diff.renames=false", "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, err
+	}
+	var notes []string
+	for _, name := range strings.Fields(out) {
+		if !strings.HasPrefix(name, "todos/") || !strings.HasSuffix(name, ".json") {
+			return nil, fmt.Errorf("%s has a merge conflict outside the todos; resolve it in %s", name, g.Dir)
+		}
+		stage := func(n int) (syncFields, error) {
+			data, err := g.run("show", fmt.Sprintf(":%d:%s", n, name))
+			if err != nil {
+				return nil, nil // the file doesn't exist on that side
+			}
+			return parseSyncFields([]byte(data))
+		}
+		base, err := stage(1)
+		if err != nil {
+			return nil, err
+		}
+		ours, err := stage(2)
+		if err != nil {
+			return nil, err
+		}
+		theirs, err := stage(3)
+		if err != nil {
+			return nil, err
+		}
+
+		title := func(f syncFields) string {
+			var s string
+			json.Unmarshal(f["Title"], &s)
+			return s
+		}
+		var merged syncFields
+		switch {
+		case ours == nil:
+			merged = theirs
+			notes = append(notes, fmt.Sprintf("%q was deleted here but changed elsewhere; kept it", title(theirs)))
+		case theirs == nil:
+			merged = ours
+			notes = append(notes, fmt.Sprintf("%q was deleted elsewhere but changed here; kept it", title(ours)))
+		default:
+			var conflicts []string
+			merged, conflicts = mergeSyncFields(base, ours, theirs)
+			note := fmt.Sprintf("merged concurrent edits to %q", title(merged))
+			if len(conflicts) > 0 {
+				note += fmt.Sprintf(" (kept the local %s)", strings.Join(conflicts, ", "))
+			}
+			notes = append(notes, note)
+		}
+		data, err := merged.encode()
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(filepath.Join(g.Dir, filepath.FromSlash(name)), data, 0600); err != nil {
+			return nil, err
+		}
+		if _, err := g.run("add", "--", name); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := g.run("commit", "--quiet", "--no-edit"); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// applySyncItems makes todos match the synced items, keyed by UID. Todos
+// keep their local IDs and order; new ones use the ID they had on the
+// machine that added them when this list never handed it out, and the next
+// ID otherwise, so IDs are never reused.
+func applySyncItems(todos *Todos, items map[string]syncFields) (added, changed, removed int) {
+	decoded := make(map[string]Todo, len(items))
+	for uid, fields := range items {
+		data, _ := json.Marshal(fields)
+		var t Todo
+		if json.Unmarshal(data, &t) != nil {
+			continue
+		}
+		t.UID = uid
+		decoded[uid] = t
+	}
+
+	ids := make(map[string]int)
+	used := make(map[int]bool)
+	var kept []Todo
+	for _, t := range todos.Items {
+		if _, ok := decoded[t.UID]; ok {
+			ids[t.UID] = t.ID
+			used[t.ID] = true
+			kept = append(kept, t)
+		} else {
+			removed++
+		}
+	}
+	var fresh []Todo
+	for uid, t := range decoded {
+		if _, ok := ids[uid]; !ok {
+			fresh = append(fresh, t)
+		}
+	}
+	slices.SortFunc(fresh, func(a, b Todo) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.UID, b.UID)
+	})
+	for _, t := range fresh {
+		id := t.ID
+		if id <= 0 || id < todos.NextID || used[id] {
+			id = max(todos.NextID, 1)
+		}
+		for used[id] {
+			id++
+		}
+		ids[t.UID] = id
+		used[id] = true
+		todos.NextID = max(todos.NextID, id+1)
+	}
+
+	resolve := func(fields syncFields, key string) int {
+		var uid string
+		json.Unmarshal(fields[key], &uid)
+		return ids[uid]
+	}
+	local := make(map[string]Todo, len(kept))
+	for _, t := range kept {
+		local[t.UID] = t
+	}
+	todos.Items = todos.Items[:0]
+	for _, t := range append(kept, fresh...) {
+		next := decoded[t.UID]
+		next.ID = ids[t.UID]
+		next.ParentID = resolve(items[t.UID], "ParentUID")
+		next.NextOccurrence = resolve(items[t.UID], "NextUID")
+		next.DependsOn = nil
+		var deps []string
+		json.Unmarshal(items[t.UID]["DependsOnUIDs"], &deps)
+		for _, uid := range deps {
+			if id, ok := ids[uid]; ok {
+				next.DependsOn = append(next.DependsOn, id)
+			}
+		}
+		if old, ok := local[t.UID]; !ok {
+			added++
+		} else if !sameTodo(old, next) {
+			changed++
+		}
+		todos.Items = append(todos.Items, next)
+	}
+	return added, changed, removed
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestGitSyncDeleteAgainstEdit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	origin := filepath.Join(root, "origin.git")
+	if out, err := exec.Command("git", "init", "--quiet", "--bare", origin).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	sync := func(clone string, todos *Todos) {
+		t.Helper()
+		g, err := openGitRepo(filepath.Join(root, clone))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := gitSync(g, "default", todos, origin); err != nil {
+			t.Fatalf("sync %s: %v", clone, err)
+		}
+	}
+
+	var a, b Todos
+	a.Add("one")
+	a.Add("two")
+	sync("a", &a)
+	sync("b", &b)
+
+	// A deletes "one" and adds "three" while B tags "one" and adds its own.
+	if err := a.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	a.Add("three")
+	if err := b.AddTags(1, "urgent"); err != nil {
+		t.Fatal(err)
+	}
+	b.Add("local-b")
+	sync("a", &a)
+	sync("b", &b)
+	sync("a", &a)
+
+	for name, todos := range map[string]*Todos{"a": &a, "b": &b} {
+		byTitle := make(map[string]Todo)
+		var ids []int
+		for _, t := range todos.Items {
+			byTitle[t.Title] = t
+			ids = append(ids, t.ID)
+		}
+		if len(byTitle) != 4 {
+			t.Errorf("%s: got %d todos, want one, two, three and local-b", name, len(byTitle))
+		}
+		if one, ok := byTitle["one"]; !ok || !one.HasTag("urgent") {
+			t.Errorf("%s: the edit to \"one\" was lost: %+v", name, one)
+		}
+		if three := byTitle["three"]; len(three.Tags) != 0 {
+			t.Errorf("%s: \"three\" picked up tags %v", name, three.Tags)
+		}
+		slices.Sort(ids)
+		if len(slices.Compact(ids)) != len(todos.Items) {
+			t.Errorf("%s: duplicate IDs %v", name, ids)
+		}
+	}
+	// A deleted todo 1, so it must not hand that ID out again.
+	for _, t2 := range a.Items {
+		if t2.ID == 1 {
+			t.Errorf("a: ID 1 was reused for %q", t2.Title)
+		}
+	}
+}
+
+func TestMergeSyncFields(t *testing.T) {
+	base := `{"ID":1,"Title":"a","Priority":"","Tags":null}`
+	tests := []struct {
+		name      string
+		ours      string
+		theirs    string
+		want      string
+		conflicts []string
+	}{
+		{"nothing changed", base, base, base, nil},
+		{"changed here", `{"ID":1,"Title":"b","Priority":"","Tags":null}`, base,
+			`{"ID":1,"Title":"b","Priority":"","Tags":null}`, nil},
+		{"changed there", base, `{"ID":1,"Title":"a","Priority":"","Tags":["x"]}`,
+			`{"ID":1,"Title":"a","Priority":"","Tags":["x"]}`, nil},
+		{"different fields on each side", `{"ID":1,"Title":"b","Priority":"","Tags":null}`, `{"ID":1,"Title":"a","Priority":"high","Tags":null}`,
+			`{"ID":1,"Title":"b","Priority":"high","Tags":null}`, nil},
+		{"same change on both sides", `{"ID":1,"Title":"b","Priority":"","Tags":null}`, `{"ID":1,"Title":"b","Priority":"","Tags":null}`,
+			`{"ID":1,"Title":"b","Priority":"","Tags":null}`, nil},
+		{"conflict keeps the local value", `{"ID":1,"Title":"b","Priority":"low","Tags":null}`, `{"ID":1,"Title":"c","Priority":"high","Tags":null}`,
+			`{"ID":1,"Title":"b","Priority":"low","Tags":null}`, []string{"Priority", "Title"}},
+		{"different ID hints", `{"ID":3,"Title":"a","Priority":"","Tags":null}`, `{"ID":7,"Title":"a","Priority":"","Tags":null}`,
+			`{"ID":3,"Title":"a","Priority":"","Tags":null}`, nil},
+		{"field added there", base, `{"ID":1,"Title":"a","Priority":"","Tags":null,"ParentUID":"p"}`,
+			`{"ID":1,"Title":"a","Priority":"","Tags":null,"ParentUID":"p"}`, nil},
+		{"field removed there", `{"ID":1,"Title":"a","Priority":"","Tags":null}`, `{"ID":1,"Title":"a","Priority":""}`,
+			`{"ID":1,"Title":"a","Priority":""}`, nil},
+	}
+	parse := func(s string) syncFields {
+		t.Helper()
+		f, err := parseSyncFields([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts := mergeSyncFields(parse(base), parse(tt.ours), parse(tt.theirs))
+			got, _ := json.Marshal(merged)
+			want, _ := json.Marshal(parse(tt.want))
+			if string(got) != string(want) {
+				t.Errorf("merged to %s, want %s", got, want)
+			}
+			if !slices.Equal(conflicts, tt.conflicts) {
+				t.Errorf("conflicts %v, want %v", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
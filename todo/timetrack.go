@@ -0,0 +1,314 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aquasecurity/table"
+)
+
+// WorkSession is a stretch of time spent on a todo. End is nil while the
+// timer is running.
+type WorkSession struct {
+	Start time.Time
+	End   *time.Time `json:",omitempty"`
+}
+
+// Timer returns the todo's running session, or nil.
+func (t *Todo) Timer() *WorkSession {
+	if n := len(t.Sessions); n > 0 && t.Sessions[n-1].End == nil {
+		return &t.Sessions[n-1]
+	}
+	return nil
+}
+
+// Tracked returns the time worked on the todo, counting a running timer up
+// to now.
+func (t *Todo) Tracked(now time.Time) time.Duration {
+	var total time.Duration
+	for _, s := range t.Sessions {
+		end := now
+		if s.End != nil {
+			end = *s.End
+		}
+		total += end.Sub(s.Start)
+	}
+	return total
+}
+
+// Start starts a timer on a todo. Only one timer runs at a time, so time
+// isn't billed twice; Start stops any other running timer and returns the
+// IDs of the todos it stopped.
+func (todos *Todos) Start(id int, now time.Time) ([]int, error) {
+	t, err := todos.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.Timer() != nil {
+		return nil, fmt.Errorf("the timer for todo %d is already running", id)
+	}
+	if t.Completed {
+		return nil, fmt.Errorf("todo %d is completed", id)
+	}
+	var stopped []int
+	for i := range todos.Items {
+		if s := todos.Items[i].Timer(); s != nil {
+			s.End = &now
+			stopped = append(stopped, todos.Items[i].ID)
+		}
+	}
+	t.Sessions = append(t.Sessions, WorkSession{Start: now})
+	return stopped, nil
+}
+
+// Stop stops the running timer of a todo and returns the session's length.
+func (todos *Todos) Stop(id int, now time.Time) (time.Duration, error) {
+	t, err := todos.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	s := t.Timer()
+	if s == nil {
+		return 0, fmt.Errorf("no timer is running for todo %d", id)
+	}
+	s.End = &now
+	return now.Sub(s.Start), nil
+}
+
+// Running returns the IDs of the todos whose timer is running.
+func (todos *Todos) Running() []int {
+	var ids []int
+	for i := range todos.Items {
+		if todos.Items[i].Timer() != nil {
+			ids = append(ids, todos.Items[i].ID)
+		}
+	}
+	return ids
+}
+
+// formatDuration shows a duration as hours and minutes, such as "2:05".
+func formatDuration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
+
+var reportGroups = []string{"item", "tag", "day"}
+
+// ReportRow is the time tracked for one item, tag or day.
+type ReportRow struct {
+	Key   string // todo ID, tag or YYYY-MM-DD
+	Title string // the todo's title when grouping by item
+	Tags  []string
+	Time  time.Duration
+}
+
+// Report sums the time tracked in [from, to) by item, tag or day. Sessions
+// are cut at the range edges, a running timer counts up to now, and a
+// session's time counts toward every tag of its todo. Untagged time is
+// reported under "(untagged)". Items and tags are sorted by time, days by
+// date.
+func (todos *Todos) Report(from, to, now time.Time, by string) ([]ReportRow, error) {
+	if !slices.Contains(reportGroups, by) {
+		return nil, fmt.Errorf("invalid grouping %q (use %s)", by, strings.Join(reportGroups, ", "))
+	}
+	rows := make(map[string]*ReportRow)
+	add := func(key string, t Todo, d time.Duration) {
+		row, ok := rows[key]
+		if !ok {
+			row = &ReportRow{Key: key}
+			if by == "item" {
+				row.Title, row.Tags = t.Title, t.Tags
+			}
+			rows[key] = row
+		}
+		row.Time += d
+	}
+
+	for _, t := range todos.Items {
+		for _, s := range t.Sessions {
+			start, end := s.Start, now
+			if s.End != nil {
+				end = *s.End
+			}
+			start, end = later(start, from), earlier(end, to)
+			// Split at midnight so each day gets its own share.
+			for start.Before(end) {
+				dayEnd := earlier(startOfDay(start).AddDate(0, 0, 1), end)
+				d := dayEnd.Sub(start)
+				switch by {
+				case "item":
+					add(strconv.Itoa(t.ID), t, d)
+				case "day":
+					add(start.Format("2006-01-02"), t, d)
+				case "tag":
+					if len(t.Tags) == 0 {
+						add("(untagged)", t, d)
+					}
+					for _, tag := range t.Tags {
+						add(tag, t, d)
+					}
+				}
+				start = dayEnd
+			}
+		}
+	}
+
+	result := make([]ReportRow, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, *row)
+	}
+	slices.SortFunc(result, func(a, b ReportRow) int {
+		if by == "day" {
+			return cmp.Compare(a.Key, b.Key)
+		}
+		if c := cmp.Compare(b.Time, a.Time); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return result, nil
+}
+
+func earlier(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// printReport renders a report as a table with a total.
+func printReport(w io.Writer, rows []ReportRow, by string) {
+	tbl := table.New(w)
+	var total time.Duration
+	for _, row := range rows {
+		total += row.Time
+	}
+	switch by {
+	case "item":
+		tbl.SetHeaders("ID", "Title", "Tags", "Time")
+		for _, row := range rows {
+			tbl.AddRow(row.Key, row.Title, strings.Join(row.Tags, ", "), formatDuration(row.Time))
+		}
+		tbl.SetFooters("", "Total", "", formatDuration(total))
+	default:
+		tbl.SetHeaders(strings.ToUpper(by[:1])+by[1:], "Time")
+		for _, row := range rows {
+			tbl.AddRow(row.Key, formatDuration(row.Time))
+		}
+		if by == "day" {
+			// Tags overlap, so only items and days have a meaningful total.
+			tbl.SetFooters("Total", formatDuration(total))
+		}
+	}
+	tbl.Render()
+}
+
+// writeReportCSV writes a report with both an h:mm duration and decimal
+// hours, which is what invoicing tools usually want.
+func writeReportCSV(w io.Writer, rows []ReportRow, by string) error {
+	cw := csv.NewWriter(w)
+	header := []string{by, "duration", "hours"}
+	if by == "item" {
+		header = []string{"id", "title", "tags", "duration", "hours"}
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := []string{row.Key}
+		if by == "item" {
+			record = append(record, row.Title, strings.Join(row.Tags, " "))
+		}
+		record = append(record, formatDuration(row.Time), strconv.FormatFloat(row.Time.Hours(), 'f', 2, 64))
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// parseReportRange turns the -from and -to flags of `todo report` into a
+// half-open range. A -to date without a time of day includes that whole day.
+func parseReportRange(fromFlag, toFlag string, now time.Time) (time.Time, time.Time, error) {
+	from, err := parseReportDate(fromFlag, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parseReportDate(toFlag, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if allDay(to) {
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("the report range %s to %s is empty", fromFlag, toFlag)
+	}
+	return from, to, nil
+}
+
+// parseReportDate reads a -from or -to date. Reports look back, so besides
+// the due dates ParseDue understands it takes "yesterday" and offsets into
+// the past such as "-7d", "-2w", "-1m" or "-1y".
+func parseReportDate(s string, now time.Time) (time.Time, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	today := startOfDay(now)
+	if s == "yesterday" {
+		return today.AddDate(0, 0, -1), nil
+	}
+	if strings.HasPrefix(s, "-") && len(s) > 2 {
+		n, err := strconv.Atoi(s[1 : len(s)-1])
+		if err == nil && n >= 0 {
+			switch s[len(s)-1] {
+			case 'd':
+				return today.AddDate(0, 0, -n), nil
+			case 'w':
+				return today.AddDate(0, 0, -7*n), nil
+			case 'm':
+				return today.AddDate(0, -n, 0), nil
+			case 'y':
+				return today.AddDate(-n, 0, 0), nil
+			}
+		}
+	}
+	t, err := ParseDue(s, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid report date %q (use YYYY-MM-DD, today, yesterday or -Nd/-Nw/-Nm/-Ny)", s)
+	}
+	return t, nil
+}
+
+// writeReport writes a report to stdout or, with a file name, to that file.
+func writeReport(fileName, format string, rows []ReportRow, by string) error {
+	var w io.Writer = os.Stdout
+	var buf strings.Builder
+	if fileName != "" {
+		w = &buf
+	}
+	if format == "csv" {
+		if err := writeReportCSV(w, rows, by); err != nil {
+			return err
+		}
+	} else {
+		printReport(w, rows, by)
+	}
+	if fileName == "" {
+		return nil
+	}
+	return writeFileAtomic(fileName, []byte(buf.String()), 0644)
+}
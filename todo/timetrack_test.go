@@ -0,0 +1,134 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+	ended := func(start, end time.Time) WorkSession { return WorkSession{Start: start, End: &end} }
+	now := at(14, 10, 30)
+	todos := Todos{Items: []Todo{
+		// Across midnight.
+		{ID: 1, Title: "Write", Tags: []string{"work"}, Sessions: []WorkSession{ended(at(13, 22, 0), at(14, 2, 0))}},
+		// Starts the day before the range.
+		{ID: 2, Title: "Read", Sessions: []WorkSession{ended(at(12, 23, 0), at(13, 1, 0))}},
+		// Still running.
+		{ID: 3, Title: "Call", Tags: []string{"work", "phone"}, Sessions: []WorkSession{{Start: at(14, 9, 0)}}},
+	}}
+
+	type row struct {
+		key  string
+		time time.Duration
+	}
+	tests := []struct {
+		name     string
+		from, to time.Time
+		by       string
+		want     []row
+	}{
+		{"by day", at(13, 0, 0), at(15, 0, 0), "day", []row{{"2026-10-13", 3 * time.Hour}, {"2026-10-14", 3*time.Hour + 30*time.Minute}}},
+		{"by item", at(13, 0, 0), at(15, 0, 0), "item", []row{{"1", 4 * time.Hour}, {"3", 90 * time.Minute}, {"2", time.Hour}}},
+		{"by tag", at(13, 0, 0), at(15, 0, 0), "tag", []row{{"work", 5*time.Hour + 30*time.Minute}, {"phone", 90 * time.Minute}, {"(untagged)", time.Hour}}},
+		{"one day", at(13, 0, 0), at(14, 0, 0), "item", []row{{"1", 2 * time.Hour}, {"2", time.Hour}}},
+		{"part of a session", at(14, 1, 0), at(14, 9, 30), "item", []row{{"1", time.Hour}, {"3", 30 * time.Minute}}},
+		{"after the timer", at(14, 10, 0), at(14, 12, 0), "item", []row{{"3", 30 * time.Minute}}},
+		{"nothing tracked", at(1, 0, 0), at(2, 0, 0), "day", nil},
+	}
+	for _, tt := range tests {
+		rows, err := todos.Report(tt.from, tt.to, now, tt.by)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []row
+		for _, r := range rows {
+			got = append(got, row{r.Key, r.Time})
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if _, err := todos.Report(at(13, 0, 0), at(15, 0, 0), now, "week"); err == nil {
+		t.Error("Report accepted an unknown grouping")
+	}
+}
+
+func TestParseReportRange(t *testing.T) {
+	// A Wednesday afternoon.
+	now := time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC)
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		from, to         string
+		wantFrom, wantTo time.Time
+	}{
+		{"today", "today", day(2026, 10, 14), day(2026, 10, 15)},
+		{"yesterday", "yesterday", day(2026, 10, 13), day(2026, 10, 14)},
+		{"-1w", "today", day(2026, 10, 7), day(2026, 10, 15)},
+		{"-1m", "-1d", day(2026, 9, 14), day(2026, 10, 14)},
+		{"-1y", "-0d", day(2025, 10, 14), day(2026, 10, 15)},
+		{"2026-10-01", "2026-10-31", day(2026, 10, 1), day(2026, 11, 1)},
+		{"2026-10-01 09:00", "2026-10-01 17:30", time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 17, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		from, to, err := parseReportRange(tt.from, tt.to, now)
+		if err != nil {
+			t.Errorf("%s to %s: %v", tt.from, tt.to, err)
+			continue
+		}
+		if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+			t.Errorf("%s to %s: [%v, %v), want [%v, %v)", tt.from, tt.to, from, to, tt.wantFrom, tt.wantTo)
+		}
+	}
+
+	for _, bad := range [][2]string{{"today", "yesterday"}, {"2026-10-01 17:00", "2026-10-01 09:00"}, {"soon", "today"}, {"today", "-3x"}} {
+		if _, _, err := parseReportRange(bad[0], bad[1], now); err == nil {
+			t.Errorf("%s to %s: no error", bad[0], bad[1])
+		}
+	}
+}
+
+func TestTimers(t *testing.T) {
+	start := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	var todos Todos
+	write := todos.Add("Write")
+	read := todos.Add("Read")
+	done := todos.Add("Done")
+	todos.Toggle(done)
+
+	if stopped, err := todos.Start(write, start); err != nil || len(stopped) != 0 {
+		t.Fatalf("Start: stopped %v, %v", stopped, err)
+	}
+	if _, err := todos.Start(write, start); err == nil {
+		t.Error("started a running timer again")
+	}
+	if _, err := todos.Start(done, start); err == nil {
+		t.Error("started a timer on a completed todo")
+	}
+	// Starting another timer stops the first.
+	if stopped, err := todos.Start(read, start.Add(time.Hour)); err != nil || !slices.Equal(stopped, []int{write}) {
+		t.Errorf("Start stopped %v (%v), want [%d]", stopped, err, write)
+	}
+	if got := todos.Running(); !slices.Equal(got, []int{read}) {
+		t.Errorf("running %v, want [%d]", got, read)
+	}
+	if _, err := todos.Stop(write, start.Add(2*time.Hour)); err == nil {
+		t.Error("stopped a timer that isn't running")
+	}
+	r, _ := todos.Get(read)
+	if got := r.Tracked(start.Add(90 * time.Minute)); got != 30*time.Minute {
+		t.Errorf("tracked %v on a running timer, want 30m", got)
+	}
+	if d, err := todos.Stop(read, start.Add(2*time.Hour)); err != nil || d != time.Hour {
+		t.Errorf("Stop = %v, %v; want 1h", d, err)
+	}
+	w, _ := todos.Get(write)
+	if got := w.Tracked(start.Add(5 * time.Hour)); got != time.Hour {
+		t.Errorf("tracked %v on a stopped timer, want 1h", got)
+	}
+}
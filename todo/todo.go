@@ -1,10 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aquasecurity/table"
@@ -12,76 +15,303 @@ import (
 
 // Exported type (renamed to start with an uppercase letter)
 type Todo struct {
+	ID          int
 	Title       string
 	Completed   bool
 	CreatedAt   time.Time
 	CompletedAt *time.Time // pointer because it might be null
+	Due         *time.Time
+	Priority    Priority
+	Tags        []string
+	Repeat      *Recurrence
+	// NextOccurrence is the ID of the todo created when this recurring todo
+	// was completed; it stops a second completion creating another one.
+	NextOccurrence int
+	// ParentID is the todo this one is a subtask of, or 0 for a top-level
+	// todo. AutoComplete completes a todo once all its subtasks are done.
+	ParentID     int
+	AutoComplete bool
+	// Sessions are the stretches of time worked on the todo, oldest first.
+	Sessions []WorkSession `json:",omitempty"`
+	// DependsOn are the todos this one waits on; see deps.go.
+	DependsOn []int `json:",omitempty"`
+	// UID identifies the todo across machines when the list is synced.
+	UID string `json:",omitempty"`
 }
 
-// Exported type (renamed to start with an uppercase letter)
-type Todos []Todo
+// Todos holds the list together with the next ID to hand out, so IDs are
+// never reused even after the highest one is deleted.
+type Todos struct {
+	NextID int
+	Items  []Todo
+
+	// source is the full list a Query result was taken from, so subtask
+	// progress still counts the subtasks a filter left out.
+	source *Todos
+}
 
-func (todos *Todos) Add(title string) {
+// Add appends a new pending todo and returns its ID.
+func (todos *Todos) Add(title string) int {
+	todos.ensureIDs()
 	todo := Todo{
+		ID:          todos.NextID,
 		Title:       title,
 		Completed:   false,
 		CompletedAt: nil,
 		CreatedAt:   time.Now(),
+		UID:         newUID(),
 	}
+	todos.NextID++
+
+	todos.Items = append(todos.Items, todo)
+	return todo.ID
+}
 
-	*todos = append(*todos, todo)
+// ensureIDs gives an ID to every todo that doesn't have one yet (files written
+// before IDs existed) and makes sure NextID is past every ID in use.
+func (todos *Todos) ensureIDs() {
+	for _, t := range todos.Items {
+		if t.ID >= todos.NextID {
+			todos.NextID = t.ID + 1
+		}
+	}
+	if todos.NextID < 1 {
+		todos.NextID = 1
+	}
+	for i := range todos.Items {
+		if todos.Items[i].ID == 0 {
+			todos.Items[i].ID = todos.NextID
+			todos.NextID++
+		}
+	}
 }
 
-func (todos *Todos) validateIndex(index int) error {
-	if index < 0 || index >= len(*todos) {
-		err := errors.New("invalid index")
-		fmt.Println(err)
+// UnmarshalJSON accepts both the current object layout and the old bare array
+// of todos, assigning IDs to anything loaded without one.
+func (todos *Todos) UnmarshalJSON(data []byte) error {
+	var items []Todo
+	if err := json.Unmarshal(data, &items); err == nil {
+		*todos = Todos{Items: items}
+		todos.ensureIDs()
+		return nil
+	}
+
+	type plain Todos
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
 		return err
 	}
+	*todos = Todos(p)
+	todos.ensureIDs()
 	return nil
 }
 
-func (todos *Todos) Delete(index int) error {
-	if err := todos.validateIndex(index); err != nil {
+var errNoTodo = errors.New("no todo with id")
+
+func (todos *Todos) indexOf(id int) (int, error) {
+	for i, t := range todos.Items {
+		if t.ID == id {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("%w %d", errNoTodo, id)
+}
+
+// Get returns the todo with the given ID. The pointer is only valid until the
+// list is next modified.
+func (todos *Todos) Get(id int) (*Todo, error) {
+	index, err := todos.indexOf(id)
+	if err != nil {
+		return nil, err
+	}
+	return &todos.Items[index], nil
+}
+
+// Delete removes a todo together with all of its subtasks.
+func (todos *Todos) Delete(id int) error {
+	index, err := todos.indexOf(id)
+	if err != nil {
 		return err
 	}
+	parent := todos.Items[index].ParentID
+	for _, child := range todos.descendants(id) {
+		i, _ := todos.indexOf(child)
+		todos.Items = append(todos.Items[:i], todos.Items[i+1:]...)
+	}
 
-	*todos = append((*todos)[:index], (*todos)[index+1:]...)
-	return nil
+	index, _ = todos.indexOf(id)
+	todos.Items = append(todos.Items[:index], todos.Items[index+1:]...)
+	todos.dropDependencies()
+	return todos.syncParent(parent)
 }
 
-func (todos *Todos) Toggle(index int) error {
-	t := *todos
-	if err := t.validateIndex(index); err != nil {
+// Toggle flips the completion state of a todo. Completing a recurring todo
+// adds its next occurrence; the completed one keeps its completion time.
+// Completing a todo also stops its timer, and reopening one clears its
+// completion time.
+func (todos *Todos) Toggle(id int) error {
+	index, err := todos.indexOf(id)
+	if err != nil {
 		return err
 	}
+	t := todos.Items
 	isCompleted := t[index].Completed
 
 	if !isCompleted {
 		completionTime := time.Now()
 		t[index].CompletedAt = &completionTime
+		if s := t[index].Timer(); s != nil {
+			s.End = &completionTime
+		}
+	} else {
+		t[index].CompletedAt = nil
 	}
 	t[index].Completed = !isCompleted
+
+	if !isCompleted && t[index].Repeat != nil && t[index].NextOccurrence == 0 {
+		todos.addNextOccurrence(index)
+	}
+	return todos.syncParent(t[index].ParentID)
+}
+
+func (todos *Todos) addNextOccurrence(index int) {
+	done := todos.Items[index]
+	repeat := *done.Repeat
+	if repeat.Freq == "monthly" && repeat.MonthDay == 0 {
+		// Keep the day the rule started on, so a todo due on the 31st
+		// comes back on the 31st after a short month instead of the 28th.
+		anchor := *done.CompletedAt
+		if done.Due != nil {
+			anchor = *done.Due
+		}
+		repeat.MonthDay = anchor.Day()
+	}
+	due := repeat.nextDue(done.Due, *done.CompletedAt)
+
+	id := todos.Add(done.Title)
+	next := &todos.Items[len(todos.Items)-1]
+	next.Due = &due
+	next.Priority = done.Priority
+	next.Tags = slices.Clone(done.Tags)
+	next.Repeat = &repeat
+	todos.Items[index].NextOccurrence = id
+}
+
+func (todos *Todos) Edit(id int, title string) error {
+	index, err := todos.indexOf(id)
+	if err != nil {
+		return err
+	}
+
+	todos.Items[index].Title = title
 	return nil
 }
 
-func (todos *Todos) Edit(index int, title string) error {
-	t := *todos
-	if err := t.validateIndex(index); err != nil {
+// Move swaps a todo with its previous (offset < 0) or next (offset > 0)
+// sibling, the todo with the same parent next to it in the list. It reports
+// whether the todo moved; a todo already at the edge stays put.
+func (todos *Todos) Move(id, offset int) (bool, error) {
+	index, err := todos.indexOf(id)
+	if err != nil {
+		return false, err
+	}
+	parent := todos.Items[index].ParentID
+	for i := index + offset; i >= 0 && i < len(todos.Items); i += offset {
+		if todos.Items[i].ParentID == parent {
+			todos.Items[index], todos.Items[i] = todos.Items[i], todos.Items[index]
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SetDue sets the due time of a todo; nil removes it.
+func (todos *Todos) SetDue(id int, due *time.Time) error {
+	t, err := todos.Get(id)
+	if err != nil {
 		return err
 	}
+	t.Due = due
+	return nil
+}
 
-	t[index].Title = title
+// SetRepeat sets how a todo recurs; nil makes it a one-off.
+func (todos *Todos) SetRepeat(id int, repeat *Recurrence) error {
+	t, err := todos.Get(id)
+	if err != nil {
+		return err
+	}
+	t.Repeat = repeat
 	return nil
 }
 
+func (todos *Todos) SetPriority(id int, priority Priority) error {
+	t, err := todos.Get(id)
+	if err != nil {
+		return err
+	}
+	t.Priority = priority
+	return nil
+}
+
+// AddTags adds tags to a todo, skipping ones it already has.
+func (todos *Todos) AddTags(id int, tags ...string) error {
+	t, err := todos.Get(id)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag != "" && !t.HasTag(tag) {
+			t.Tags = append(t.Tags, tag)
+		}
+	}
+	return nil
+}
+
+func (todos *Todos) RemoveTags(id int, tags ...string) error {
+	t, err := todos.Get(id)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		t.Tags = slices.DeleteFunc(t.Tags, func(existing string) bool {
+			return existing == normalizeTag(tag)
+		})
+	}
+	if len(t.Tags) == 0 {
+		t.Tags = nil
+	}
+	return nil
+}
+
+func (t *Todo) HasTag(tag string) bool {
+	return slices.Contains(t.Tags, normalizeTag(tag))
+}
+
+// normalizeTag lower-cases a tag and drops a leading '#'.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
 func (todos *Todos) Print() {
 	table := table.New(os.Stdout)
 	table.SetRowLines(true)
-	table.SetHeaders("#", "Title", "Completed", "Created At", "Completed At")
-	for index, t := range *todos {
+	table.SetHeaders("ID", "Title", "Priority", "Due", "Tags", "Completed", "Created At", "Completed At")
+	now := time.Now()
+	for _, row := range todos.Tree() {
+		t := row.Todo
 		completed := "❌"
 		completedAt := ""
+		due := ""
+
+		if t.Due != nil {
+			due = formatDue(*t.Due)
+			if t.IsOverdue(now) {
+				// Overdue items are shown in red so they stand out.
+				due = "\x1b[31m⚠ " + due + "\x1b[0m"
+			}
+		}
 
 		if t.Completed {
 			completed = "✅"
@@ -89,7 +319,25 @@ func (todos *Todos) Print() {
 				completedAt = t.CompletedAt.Format(time.RFC1123)
 			}
 		}
-		table.AddRow(strconv.Itoa(index), t.Title, completed, t.CreatedAt.Format(time.RFC1123), completedAt)
+		title := t.Title
+		if t.Repeat != nil {
+			title += " 🔁 " + t.Repeat.String()
+		}
+		if s := t.Timer(); s != nil {
+			title += " ⏱ " + formatDuration(now.Sub(s.Start))
+		}
+		all := todos
+		if todos.source != nil {
+			all = todos.source
+		}
+		if done, total := all.Progress(t.ID); total > 0 {
+			title += fmt.Sprintf(" [%d/%d]", done, total)
+		}
+		if blockers := all.Blockers(t.ID); len(blockers) > 0 && !t.Completed {
+			title += " ⛔ " + formatIDs(blockers)
+		}
+		title = indentTitle(title, row.Depth)
+		table.AddRow(strconv.Itoa(t.ID), title, t.Priority.String(), due, strings.Join(t.Tags, ", "), completed, t.CreatedAt.Format(time.RFC1123), completedAt)
 	}
 	table.Render()
 }
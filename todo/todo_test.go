@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestAddNeverReusesIDs(t *testing.T) {
+	var todos Todos
+	first := todos.Add("first")
+	second := todos.Add("second")
+	if err := todos.Delete(second); err != nil {
+		t.Fatal(err)
+	}
+	third := todos.Add("third")
+	if first != 1 || second != 2 || third != 3 {
+		t.Errorf("got IDs %d, %d, %d; want 1, 2, 3", first, second, third)
+	}
+	if todos.NextID != 4 {
+		t.Errorf("NextID = %d, want 4", todos.NextID)
+	}
+}
+
+func TestUnmarshalTodos(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		ids    []int
+		nextID int
+	}{
+		{"bare array", `[{"Title":"a"},{"Title":"b"}]`, []int{1, 2}, 3},
+		{"bare array with some IDs", `[{"ID":5,"Title":"a"},{"Title":"b"}]`, []int{5, 6}, 7},
+		{"empty array", `[]`, nil, 1},
+		{"object", `{"NextID":10,"Items":[{"ID":3,"Title":"a"}]}`, []int{3}, 10},
+		{"object with a stale NextID", `{"NextID":2,"Items":[{"ID":4,"Title":"a"}]}`, []int{4}, 5},
+		{"object without IDs", `{"Items":[{"Title":"a"}]}`, []int{1}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var todos Todos
+			if err := json.Unmarshal([]byte(tt.data), &todos); err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, item := range todos.Items {
+				ids = append(ids, item.ID)
+			}
+			if !slices.Equal(ids, tt.ids) || todos.NextID != tt.nextID {
+				t.Errorf("got IDs %v and NextID %d, want %v and %d", ids, todos.NextID, tt.ids, tt.nextID)
+			}
+		})
+	}
+}
+
+func TestGetMissingTodo(t *testing.T) {
+	var todos Todos
+	todos.Add("a")
+	if _, err := todos.Get(2); err == nil {
+		t.Error("Get(2) succeeded on a list without todo 2")
+	}
+	if err := todos.Delete(2); err == nil {
+		t.Error("Delete(2) succeeded on a list without todo 2")
+	}
+}
+
+func TestToggle(t *testing.T) {
+	var todos Todos
+	id := todos.Add("a")
+	if err := todos.Toggle(id); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := todos.Get(id); !got.Completed || got.CompletedAt == nil {
+		t.Fatalf("completed todo: %+v", got)
+	}
+	if err := todos.Toggle(id); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := todos.Get(id); got.Completed || got.CompletedAt != nil {
+		t.Errorf("reopened todo is completed %v at %v, want pending without a completion time", got.Completed, got.CompletedAt)
+	}
+	if err := todos.Toggle(9); err == nil {
+		t.Error("Toggle(9) succeeded on a list without todo 9")
+	}
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// The TUI keeps no lock while it waits for keys. Every change goes through
+// updateList, so it is locked, saved and recorded for undo exactly like a CLI
+// command, and the screen always shows the list as it was saved.
+
+type tuiMode int
+
+const (
+	modeList tuiMode = iota
+	modeAdd
+	modeEdit
+	modeFilter
+	modeDelete
+)
+
+type tui struct {
+	store   Store[Todos]
+	history *Storage[History]
+	name    string
+
+	todos  Todos
+	rows   []treeRow
+	cursor int // index into rows
+	offset int // first row on screen
+	filter string
+
+	mode   tuiMode
+	input  []rune
+	target int // todo being edited or deleted, or the parent of a new todo
+	status string
+
+	out           *bufio.Writer
+	width, height int
+}
+
+func runTUI(cmd *Command, todos *Todos, args []string) error {
+	args, err := cmd.parse(cmd.flagSet(), args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return usagef("usage: todo %s", cmd.Usage)
+	}
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return errors.New("tui needs a terminal")
+	}
+
+	store, history, err := openCurrentStore()
+	if err != nil {
+		return usagef("%v", err)
+	}
+	name := options.List
+	if options.Remote != "" {
+		name = options.Remote
+	} else if name == "" {
+		name = options.File
+	}
+	t := &tui{store: store, history: history, name: name, out: bufio.NewWriter(os.Stdout)}
+	if err := t.reload(); err != nil {
+		return err
+	}
+
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(in, state)
+	// Use the alternate screen so the shell's scrollback is left as it was.
+	t.out.WriteString("\x1b[?1049h")
+	defer func() {
+		t.out.WriteString("\x1b[?25h\x1b[?1049l")
+		t.out.Flush()
+	}()
+
+	buf := make([]byte, 256)
+	for {
+		t.width, t.height, err = term.GetSize(out)
+		if err != nil {
+			return err
+		}
+		t.draw()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			if quit := t.handle(key); quit {
+				return nil
+			}
+		}
+	}
+}
+
+// parseKeys splits terminal input into key names ("up", "enter", "ctrl-c",
+// ...) and single characters.
+func parseKeys(b []byte) []string {
+	sequences := map[string]string{
+		"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+		"\x1bOA": "up", "\x1bOB": "down", "\x1bOC": "right", "\x1bOD": "left",
+		"\x1b[H": "home", "\x1b[F": "end", "\x1b[1~": "home", "\x1b[4~": "end",
+		"\x1b[5~": "pgup", "\x1b[6~": "pgdown", "\x1b[3~": "delete",
+	}
+	var keys []string
+	for len(b) > 0 {
+		if b[0] == 0x1b && len(b) > 1 {
+			end := 2
+			for end < len(b) && end < 8 && (b[end] < 0x40 || b[end] > 0x7e) {
+				end++
+			}
+			if end < len(b) {
+				end++
+			}
+			if name, ok := sequences[string(b[:end])]; ok {
+				keys = append(keys, name)
+			}
+			b = b[end:]
+			continue
+		}
+		switch b[0] {
+		case 0x1b:
+			keys = append(keys, "esc")
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case 0x7f, 0x08:
+			keys = append(keys, "backspace")
+		case 0x03:
+			keys = append(keys, "ctrl-c")
+		case 0x15:
+			keys = append(keys, "ctrl-u")
+		case 0x17:
+			keys = append(keys, "ctrl-w")
+		default:
+			// A character split across reads decodes as RuneError and is
+			// dropped rather than typed as U+FFFD.
+			r, size := utf8.DecodeRune(b)
+			if r != utf8.RuneError && unicode.IsPrint(r) {
+				keys = append(keys, string(r))
+			}
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// parseFilter reads the filter box: #words are tags, is:pending, is:done and
+// is:actionable pick by state, and any other words must appear in the title.
+func parseFilter(filter string) Query {
+	q := Query{SortBy: "list"}
+	var words []string
+	for _, word := range strings.Fields(filter) {
+		switch {
+		case word == "is:pending":
+			q.Pending = true
+		case word == "is:done":
+			q.Done = true
+		case word == "is:actionable":
+			q.Actionable = true
+		case strings.HasPrefix(word, "#") && len(word) > 1:
+			q.Tags = append(q.Tags, normalizeTag(word))
+		default:
+			words = append(words, word)
+		}
+	}
+	q.Search = strings.Join(words, " ")
+	return q
+}
+
+func (t *tui) selected() (Todo, bool) {
+	if t.cursor < 0 || t.cursor >= len(t.rows) {
+		return Todo{}, false
+	}
+	return t.rows[t.cursor].Todo, true
+}
+
+func (t *tui) reload() error {
+	todos, err := viewList(t.store)
+	if err != nil {
+		return err
+	}
+	t.todos = todos
+	t.refresh(0)
+	return nil
+}
+
+// refresh rebuilds the visible rows, keeping the cursor on todo id (or on
+// the selected todo when id is 0) if it is still shown.
+func (t *tui) refresh(id int) {
+	if id == 0 {
+		if sel, ok := t.selected(); ok {
+			id = sel.ID
+		}
+	}
+	result, _ := t.todos.Query(parseFilter(t.filter))
+	t.rows = result.Tree()
+	for i, row := range t.rows {
+		if row.Todo.ID == id {
+			t.cursor = i
+			return
+		}
+	}
+	t.clampCursor()
+}
+
+func (t *tui) clampCursor() {
+	t.cursor = max(min(t.cursor, len(t.rows)-1), 0)
+}
+
+// change applies fn to the stored list, then shows the saved list.
+func (t *tui) change(command string, fn func(todos *Todos) error) bool {
+	todos, err := updateList(t.store, t.history, "tui "+command, fn)
+	if err != nil {
+		t.status = err.Error()
+		if err := t.reload(); err != nil {
+			t.status += "; " + err.Error()
+		}
+		return false
+	}
+	t.todos = todos
+	return true
+}
+
+// handle acts on one key and reports whether the TUI should exit.
+func (t *tui) handle(key string) bool {
+	if t.mode == modeDelete {
+		if key == "y" || key == "Y" {
+			id := t.target
+			if t.change("delete", func(todos *Todos) error { return todos.Delete(id) }) {
+				t.status = fmt.Sprintf("Deleted todo %d", id)
+				t.refresh(0)
+			}
+		} else {
+			t.status = ""
+		}
+		t.mode = modeList
+		return false
+	}
+	if t.mode != modeList {
+		t.handleInput(key)
+		return false
+	}
+
+	t.status = ""
+	page := max(t.listHeight()-1, 1)
+	sel, ok := t.selected()
+	switch key {
+	case "q", "ctrl-c":
+		return true
+	case "up", "k":
+		t.cursor = max(t.cursor-1, 0)
+	case "down", "j":
+		t.cursor = min(t.cursor+1, len(t.rows)-1)
+	case "pgup":
+		t.cursor = max(t.cursor-page, 0)
+	case "pgdown":
+		t.cursor = min(t.cursor+page, len(t.rows)-1)
+	case "home", "g":
+		t.cursor = 0
+	case "end", "G":
+		t.cursor = len(t.rows) - 1
+	case " ", "x":
+		toggle := func(todos *Todos) error {
+			if t, err := todos.Get(sel.ID); err == nil && !t.Completed {
+				if err := todos.checkBlocked(sel.ID); err != nil {
+					return err
+				}
+			}
+			return todos.Toggle(sel.ID)
+		}
+		if ok && t.change("toggle", toggle) {
+			t.refresh(sel.ID)
+		}
+	case "K", "J":
+		offset := -1
+		if key == "J" {
+			offset = 1
+		}
+		if ok && t.change("move", func(todos *Todos) error {
+			_, err := todos.Move(sel.ID, offset)
+			return err
+		}) {
+			t.refresh(sel.ID)
+		}
+	case "a", "A":
+		t.target = 0
+		if key == "A" {
+			if !ok {
+				break
+			}
+			t.target = sel.ID
+		}
+		t.mode, t.input = modeAdd, nil
+	case "e", "enter":
+		if ok {
+			t.mode, t.target, t.input = modeEdit, sel.ID, []rune(sel.Title)
+		}
+	case "d", "delete":
+		if ok {
+			t.mode, t.target = modeDelete, sel.ID
+			t.status = fmt.Sprintf("Delete %q and its subtasks? (y/n)", sel.Title)
+		}
+	case "/":
+		t.mode, t.input = modeFilter, []rune(t.filter)
+	case "esc":
+		t.filter = ""
+		t.refresh(0)
+	case "r":
+		if err := t.reload(); err != nil {
+			t.status = err.Error()
+		}
+	}
+	t.clampCursor()
+	return false
+}
+
+// handleInput edits the text of the add, edit and filter prompts.
+func (t *tui) handleInput(key string) {
+	switch key {
+	case "esc", "ctrl-c":
+		if t.mode == modeFilter {
+			t.filter = ""
+			t.refresh(0)
+		}
+		t.mode = modeList
+		return
+	case "enter":
+		t.submit()
+		return
+	case "backspace":
+		if len(t.input) > 0 {
+			t.input = t.input[:len(t.input)-1]
+		}
+	case "ctrl-u":
+		t.input = nil
+	case "ctrl-w":
+		text := strings.TrimRightFunc(string(t.input), unicode.IsSpace)
+		t.input = []rune(text[:strings.LastIndexFunc(text, unicode.IsSpace)+1])
+	default:
+		if utf8.RuneCountInString(key) == 1 {
+			t.input = append(t.input, []rune(key)...)
+		}
+	}
+	if t.mode == modeFilter {
+		// The filter applies as you type.
+		t.filter = string(t.input)
+		t.refresh(0)
+	}
+}
+
+func (t *tui) submit() {
+	text := strings.TrimSpace(string(t.input))
+	mode := t.mode
+	t.mode = modeList
+	switch mode {
+	case modeFilter:
+		t.filter = text
+		t.refresh(0)
+	case modeAdd:
+		if text == "" {
+			return
+		}
+		var id int
+		parent := t.target
+		if t.change("add", func(todos *Todos) error {
+			id = todos.Add(text)
+			if parent != 0 {
+				return todos.SetParent(id, parent)
+			}
+			return nil
+		}) {
+			t.status = fmt.Sprintf("Added todo %d", id)
+			t.refresh(id)
+		}
+	case modeEdit:
+		if text == "" {
+			t.status = "The title can't be empty"
+			return
+		}
+		id := t.target
+		if t.change("edit", func(todos *Todos) error { return todos.Edit(id, text) }) {
+			t.refresh(id)
+		}
+	}
+}
+
+// listHeight is the number of screen lines for todos, after the header and
+// the two lines at the bottom.
+func (t *tui) listHeight() int {
+	return max(t.height-3, 1)
+}
+
+func (t *tui) draw() {
+	height := t.listHeight()
+	if t.cursor < t.offset {
+		t.offset = t.cursor
+	}
+	if t.cursor >= t.offset+height {
+		t.offset = t.cursor - height + 1
+	}
+	t.offset = max(min(t.offset, len(t.rows)-height), 0)
+
+	pending := 0
+	for _, item := range t.todos.Items {
+		if !item.Completed {
+			pending++
+		}
+	}
+	header := fmt.Sprintf(" todo · %s · %d pending, %d done", t.name, pending, len(t.todos.Items)-pending)
+	if t.filter != "" {
+		header += fmt.Sprintf(" · filter: %s (%d shown)", t.filter, len(t.rows))
+	}
+
+	t.out.WriteString("\x1b[?25l\x1b[H")
+	t.line("\x1b[1m", header)
+	now := time.Now()
+	for i := t.offset; i < t.offset+height; i++ {
+		switch {
+		case i < len(t.rows):
+			style := ""
+			row := t.rows[i].Todo
+			if row.Completed {
+				style = "\x1b[2m"
+			} else if row.IsOverdue(now) {
+				style = "\x1b[31m"
+			}
+			if i == t.cursor {
+				style += "\x1b[7m"
+			}
+			t.line(style, t.rowText(t.rows[i], now))
+		case i == 0 && t.filter != "":
+			t.line("", "   Nothing matches the filter. Press Esc to clear it.")
+		case i == 0:
+			t.line("", "   No todos yet. Press a to add one.")
+		default:
+			t.line("", "")
+		}
+	}
+
+	prompt := ""
+	switch t.mode {
+	case modeAdd:
+		prompt = "Add: "
+		if t.target != 0 {
+			prompt = fmt.Sprintf("Add subtask of %d: ", t.target)
+		}
+	case modeEdit:
+		prompt = fmt.Sprintf("Edit %d: ", t.target)
+	case modeFilter:
+		prompt = "Filter (words, #tag, is:pending, is:done, is:actionable): "
+	}
+	if prompt != "" {
+		t.line("", prompt+string(t.input))
+	} else {
+		t.line("\x1b[33m", t.status)
+	}
+	help := "↑↓ move  space toggle  e edit  a add  A subtask  d delete  K/J reorder  / filter  r reload  q quit"
+	if t.mode != modeList {
+		help = "enter confirm  esc cancel  ctrl-u clear  ctrl-w delete word"
+	}
+	t.out.WriteString("\x1b[2m" + runewidth.Truncate(help, t.width, "…") + "\x1b[0m\x1b[K")
+
+	if prompt != "" {
+		col := min(runewidth.StringWidth(prompt+string(t.input))+1, t.width)
+		fmt.Fprintf(t.out, "\x1b[%d;%dH\x1b[?25h", height+2, col)
+	}
+	t.out.Flush()
+}
+
+// line writes one screen line, cut to the terminal width and padded so a
+// highlighted row spans the whole line.
+func (t *tui) line(style, text string) {
+	text = runewidth.Truncate(text, t.width, "…")
+	text = runewidth.FillRight(text, t.width)
+	t.out.WriteString(style + text + "\x1b[0m\r\n")
+}
+
+func (t *tui) rowText(row treeRow, now time.Time) string {
+	item := row.Todo
+	check := "[ ]"
+	if item.Completed {
+		check = "[x]"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, " %s %4d  %s%s", check, item.ID, strings.Repeat("   ", row.Depth), item.Title)
+	if done, total := t.todos.Progress(item.ID); total > 0 {
+		fmt.Fprintf(&b, " [%d/%d]", done, total)
+	}
+	if item.Repeat != nil {
+		b.WriteString(" 🔁 " + item.Repeat.String())
+	}
+	if blockers := t.todos.Blockers(item.ID); len(blockers) > 0 && !item.Completed {
+		b.WriteString(" ⛔ " + formatIDs(blockers))
+	}
+	if s := item.Timer(); s != nil {
+		b.WriteString(" ⏱ " + formatDuration(now.Sub(s.Start)))
+	}
+	if item.Priority != PriorityNone {
+		b.WriteString(" !" + item.Priority.String())
+	}
+	if item.Due != nil {
+		b.WriteString(" · due " + formatDue(*item.Due))
+		if item.IsOverdue(now) {
+			b.WriteString(" ⚠")
+		}
+	}
+	for _, tag := range item.Tags {
+		b.WriteString(" #" + tag)
+	}
+	return b.String()
+}
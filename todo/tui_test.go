@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"characters", "ab ", []string{"a", "b", " "}},
+		{"multibyte", "ü✓", []string{"ü", "✓"}},
+		{"control keys", "\r\n\x7f\x08\x03\x15\x17", []string{"enter", "enter", "backspace", "backspace", "ctrl-c", "ctrl-u", "ctrl-w"}},
+		{"arrows", "\x1b[A\x1b[B\x1b[C\x1b[D", []string{"up", "down", "right", "left"}},
+		{"application arrows", "\x1bOA\x1bOD", []string{"up", "left"}},
+		{"home and end", "\x1b[H\x1b[1~\x1b[F\x1b[4~", []string{"home", "home", "end", "end"}},
+		{"paging and delete", "\x1b[5~\x1b[6~\x1b[3~", []string{"pgup", "pgdown", "delete"}},
+		{"sequence between characters", "a\x1b[Bb", []string{"a", "down", "b"}},
+		{"escape alone", "\x1b", []string{"esc"}},
+		{"unknown sequence", "\x1b[1;5Ax", []string{"x"}},
+		{"alt and a letter", "\x1bx", nil},
+		{"incomplete sequence", "\x1b[", nil},
+		{"incomplete parameters", "\x1b[5", nil},
+		{"split character", "a\xc3", []string{"a"}},
+		{"invalid bytes", "\xff\xfeb", []string{"b"}},
+		{"other control characters", "\x00\x01\tz", []string{"z"}},
+		{"nothing", "", nil},
+	}
+	for _, tt := range tests {
+		if got := parseKeys([]byte(tt.input)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   Query
+	}{
+		{"", Query{SortBy: "list"}},
+		{"  milk  ", Query{SortBy: "list", Search: "milk"}},
+		{"buy milk", Query{SortBy: "list", Search: "buy milk"}},
+		{"#Work #home", Query{SortBy: "list", Tags: []string{"work", "home"}}},
+		{"is:pending release #work notes", Query{SortBy: "list", Pending: true, Tags: []string{"work"}, Search: "release notes"}},
+		{"is:done is:actionable", Query{SortBy: "list", Done: true, Actionable: true}},
+		// Half-typed filters search for what's there so far.
+		{"#", Query{SortBy: "list", Search: "#"}},
+		{"is:", Query{SortBy: "list", Search: "is:"}},
+		{"is:pend", Query{SortBy: "list", Search: "is:pend"}},
+	}
+	for _, tt := range tests {
+		if got := parseFilter(tt.filter); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFilter(%q) = %+v, want %+v", tt.filter, got, tt.want)
+		}
+	}
+}